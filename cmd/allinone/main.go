@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/kotche/bot/infrastructure/health"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/app/notifier"
+	"github.com/kotche/bot/internal/app/writer"
+	"github.com/kotche/bot/internal/bootstrap"
+	"github.com/kotche/bot/internal/config"
+	notes_repo "github.com/kotche/bot/internal/repository/notes"
+	outbox_repo "github.com/kotche/bot/internal/repository/outbox"
+	tokens_repo "github.com/kotche/bot/internal/repository/tokens"
+	dialog_serv "github.com/kotche/bot/internal/service/dialog"
+	"github.com/kotche/bot/internal/service/kafka"
+	notes_serv "github.com/kotche/bot/internal/service/notes"
+	outbox_serv "github.com/kotche/bot/internal/service/outbox"
+	tokens_serv "github.com/kotche/bot/internal/service/tokens"
+	"log"
+	"sync"
+	_ "time/tzdata"
+
+	"gopkg.in/telebot.v3"
+)
+
+// allinone запускает writer и notifier в одном процессе на одном боте (TOKEN_BOT), вместо kafka - топики в памяти
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.TelegramConfig.Token == "" {
+		log.Fatal("TOKEN_BOT is required")
+	}
+
+	ctx, stop := bootstrap.SignalContext(cfg.ShutdownTimeout)
+	defer stop()
+
+	metrics.Init()
+	checks := health.NewChecks()
+	metricsServer := metrics.StartMetricsServer(cfg.HTTPConfig.WriterAddr, cfg.HTTPConfig.Pprof, checks)
+	defer metrics.ShutdownServer(metricsServer, cfg.HTTPConfig.ShutdownTimeout)
+
+	bot, err := bootstrap.NewBot(cfg.TelegramConfig.Token, cfg.TelegramConfig, cfg.TelegramConfig.WriterWebhook, checks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := bootstrap.OpenDB(cfg.PostgresConfig, checks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = bootstrap.RunMigrations(cfg.PostgresConfig); err != nil {
+		log.Fatalln("migration error:", err)
+	}
+
+	cleanup, err := bootstrap.InitTracing(cfg.TracingConfig, "allinone")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cleanup()
+
+	dialogRepo, err := bootstrap.DialogRepository(cfg.DialogConfig, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// В одном процессе kafka не нужна: топик и dead-letter топик хранятся в памяти.
+	// Relay публикует события из outbox, consumer читает доставленные напоминания.
+	memoryLog := kafka.NewMemoryLog()
+	relayBroker := memoryLog.Broker(cfg.KafkaConfig.Topic, "")
+	defer relayBroker.Close()
+	consumerBroker := memoryLog.Broker(cfg.KafkaConfig.Topic, cfg.KafkaConfig.GroupID)
+	defer consumerBroker.Close()
+	dlqBroker := memoryLog.Broker(cfg.KafkaConfig.DLQTopic, "")
+	defer dlqBroker.Close()
+
+	notesServ := notes_serv.NewDefaultService(
+		notes_repo.NewInstrumentedRepository(notes_repo.NewDefaultRepository(db)))
+	dialogServ := dialog_serv.NewDefaultService(dialogRepo, cfg.DialogConfig.TTL)
+	outboxServ := outbox_serv.NewDefaultService(outbox_repo.NewDefaultRepository(db), relayBroker)
+
+	tokensServ := tokens_serv.NewDefaultService(tokens_repo.NewInstrumentedRepository(tokens_repo.NewDefaultRepository(db)))
+	writerImpl := writer.New(bot, notesServ, dialogServ, tokensServ, "")
+	notifierImpl := notifier.New(bot, notesServ, consumerBroker, dlqBroker, outboxServ, cfg.NotifierConfig)
+
+	var inFlight sync.WaitGroup
+	bot.Use(tracing.Middleware, metrics.Middleware(append(writer.Commands, notifier.Commands...)...), trackInFlight(&inFlight))
+	writerImpl.Register()
+	notifierImpl.Register()
+
+	go func() {
+		<-ctx.Done()
+		bot.Stop()
+	}()
+	go bot.Start()
+	go writerImpl.RunDialogEviction(ctx)
+
+	notifierImpl.Run(ctx)
+
+	inFlight.Wait()
+	log.Println("allinone stopped")
+}
+
+// trackInFlight учитывает выполняющиеся обработчики writer и notifier, чтобы дождаться их при остановке
+func trackInFlight(inFlight *sync.WaitGroup) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			inFlight.Add(1)
+			defer inFlight.Done()
+			return next(c)
+		}
+	}
+}
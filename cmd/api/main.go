@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/kotche/bot/infrastructure/health"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/internal/app/api"
+	"github.com/kotche/bot/internal/bootstrap"
+	"github.com/kotche/bot/internal/config"
+	notes_repo "github.com/kotche/bot/internal/repository/notes"
+	tokens_repo "github.com/kotche/bot/internal/repository/tokens"
+	notes_serv "github.com/kotche/bot/internal/service/notes"
+	tokens_serv "github.com/kotche/bot/internal/service/tokens"
+	"log"
+	_ "time/tzdata"
+)
+
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx, stop := bootstrap.SignalContext(cfg.ShutdownTimeout)
+	defer stop()
+
+	metrics.Init()
+	checks := health.NewChecks()
+	metricsServer := metrics.StartMetricsServer(cfg.HTTPConfig.APIAddr, cfg.HTTPConfig.Pprof, checks)
+	defer metrics.ShutdownServer(metricsServer, cfg.HTTPConfig.ShutdownTimeout)
+
+	db, err := bootstrap.OpenDB(cfg.PostgresConfig, checks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	cleanup, err := bootstrap.InitTracing(cfg.TracingConfig, "api")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cleanup()
+
+	notesServ := notes_serv.NewDefaultService(
+		notes_repo.NewInstrumentedRepository(notes_repo.NewDefaultRepository(db)))
+	tokensServ := tokens_serv.NewDefaultService(tokens_repo.NewInstrumentedRepository(tokens_repo.NewDefaultRepository(db)))
+	apiImpl := api.New(notesServ, tokensServ, cfg.APIConfig)
+	apiImpl.Start(ctx, cfg.HTTPConfig.ShutdownTimeout)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/kotche/bot/internal/bootstrap"
+	"github.com/kotche/bot/internal/config"
+	"github.com/kotche/bot/internal/service/kafka"
+	"log"
+	"time"
+)
+
+// Переотправляет сообщения из dead-letter топика в исходный топик.
+// Завершается, когда новых сообщений нет дольше -idle или переотправлено -limit сообщений.
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run возвращает ошибку вместо выхода из процесса, чтобы отложенные Close успели выполниться
+func run() error {
+	groupID := flag.String("group", "dlq-replay", "consumer group for the dead-letter topic")
+	limit := flag.Int("limit", 0, "max messages to replay, 0 - no limit")
+	idle := flag.Duration("idle", 10*time.Second, "stop after no new messages for this long")
+	dryRun := flag.Bool("dry-run", false, "only print messages, do not replay or commit them")
+	batchSize := flag.Int("batch", 100, "messages replayed with one write and one commit")
+	flag.Parse()
+
+	if *batchSize <= 0 {
+		return errors.New("-batch must be positive")
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	dlqServ, err := bootstrap.NewKafka(cfg.KafkaConfig, cfg.KafkaConfig.DLQTopic, *groupID)
+	if err != nil {
+		return fmt.Errorf("failed to initialize kafka dead-letter topic: %w", err)
+	}
+	defer dlqServ.Close()
+
+	kafkaServ, err := bootstrap.NewKafka(cfg.KafkaConfig, cfg.KafkaConfig.Topic, "")
+	if err != nil {
+		return fmt.Errorf("failed to initialize kafka: %w", err)
+	}
+	defer kafkaServ.Close()
+
+	replayed := 0
+	for *limit == 0 || replayed < *limit {
+		size := *batchSize
+		if *limit > 0 {
+			size = min(size, *limit-replayed)
+		}
+		batch, letters, err := fetchBatch(dlqServ, size, *idle)
+		if err != nil {
+			return fmt.Errorf("failed to read dead-letter topic: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		replayed += len(letters)
+		if *dryRun {
+			continue
+		}
+
+		ctx := context.Background()
+		msgs := make([]kafka.Message, 0, len(letters))
+		for _, letter := range letters {
+			// Исходные заголовки сохраняют трассировку напоминания
+			msgs = append(msgs, kafka.Message{Key: letter.Key, Value: letter.Value, Headers: letter.Headers})
+		}
+		if len(msgs) > 0 {
+			if err = kafkaServ.SendMessages(ctx, msgs...); err != nil {
+				return fmt.Errorf("failed to replay %d messages from offset %d: %w", len(msgs), batch[0].Offset, err)
+			}
+		}
+		// Коммитятся и переотправленные, и нечитаемые сообщения, иначе нечитаемые читались бы при каждом запуске
+		if err = dlqServ.CommitMessages(ctx, batch...); err != nil {
+			return fmt.Errorf("failed to commit offsets up to %d: %w", batch[len(batch)-1].Offset, err)
+		}
+	}
+
+	log.Printf("replayed %d messages from '%s' to '%s'", replayed, cfg.KafkaConfig.DLQTopic, cfg.KafkaConfig.Topic)
+	return nil
+}
+
+// fetchBatch читает до size сообщений, пока новые приходят чаще, чем раз в idle.
+// Нечитаемые сообщения попадают в batch, но не в letters.
+func fetchBatch(dlqServ kafka.MessageBroker, size int, idle time.Duration) ([]kafka.Message, []kafka.DeadLetter, error) {
+	batch := make([]kafka.Message, 0, size)
+	letters := make([]kafka.DeadLetter, 0, size)
+	for len(batch) < size {
+		ctx, cancel := context.WithTimeout(context.Background(), idle)
+		msg, err := dlqServ.FetchMessage(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return batch, letters, err
+		}
+		batch = append(batch, msg)
+
+		letter, err := kafka.DecodeDeadLetter(msg.Value)
+		if err != nil {
+			log.Printf("offset %d: malformed dead letter, committed without replay: %v", msg.Offset, err)
+			continue
+		}
+
+		log.Printf("offset %d: %s[%d]@%d failed at %s: %s",
+			msg.Offset, letter.Topic, letter.Partition, letter.Offset, letter.FailedAt.Format(time.RFC3339), letter.Error)
+		letters = append(letters, letter)
+	}
+
+	return batch, letters, nil
+}
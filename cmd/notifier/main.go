@@ -1,77 +1,70 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
+	"github.com/kotche/bot/infrastructure/health"
 	"github.com/kotche/bot/infrastructure/metrics"
 	"github.com/kotche/bot/internal/app/notifier"
+	"github.com/kotche/bot/internal/bootstrap"
 	"github.com/kotche/bot/internal/config"
 	notes_repo "github.com/kotche/bot/internal/repository/notes"
-	"github.com/kotche/bot/internal/service/kafka"
+	outbox_repo "github.com/kotche/bot/internal/repository/outbox"
 	notes_serv "github.com/kotche/bot/internal/service/notes"
+	outbox_serv "github.com/kotche/bot/internal/service/outbox"
 	"log"
-	"time"
-
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-
-	"gopkg.in/telebot.v3"
+	_ "time/tzdata"
 )
 
-func init() {
-	location, err := time.LoadLocation("Europe/Moscow")
-	if err != nil {
-		log.Fatalf("failed to load location: %v", err)
-	}
-	time.Local = location
-	log.Println("default time zone set to Europe/Moscow")
-}
-
 func main() {
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if cfg.TelegramConfig.TokenNotifyBot == "" {
+		log.Fatal("TOKEN_NOTIFY_BOT is required, TOKEN_BOT is only for allinone")
+	}
+
+	ctx, stop := bootstrap.SignalContext(cfg.ShutdownTimeout)
+	defer stop()
+
 	metrics.Init()
-	metrics.StartMetricsServer(":8081")
+	checks := health.NewChecks()
+	metricsServer := metrics.StartMetricsServer(cfg.HTTPConfig.NotifierAddr, cfg.HTTPConfig.Pprof, checks)
+	defer metrics.ShutdownServer(metricsServer, cfg.HTTPConfig.ShutdownTimeout)
 
-	bot, err := telebot.NewBot(telebot.Settings{
-		Token:  cfg.TelegramConfig.TokenNotifyBot,
-		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
-	})
+	bot, err := bootstrap.NewBot(cfg.TelegramConfig.TokenNotifyBot, cfg.TelegramConfig, cfg.TelegramConfig.NotifierWebhook, checks)
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	db, err := bootstrap.OpenDB(cfg.PostgresConfig, checks)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer db.Close()
 
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.PostgresConfig.Host,
-		cfg.PostgresConfig.Port,
-		cfg.PostgresConfig.User,
-		cfg.PostgresConfig.Password,
-		cfg.PostgresConfig.DBName,
-		cfg.PostgresConfig.SSLMode,
-	)
-	db, err := sql.Open("postgres", connStr)
+	cleanup, err := bootstrap.InitTracing(cfg.TracingConfig, "notifier")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer cleanup()
 
-	kafkaServ, err := kafka.New(
-		cfg.KafkaConfig.Brokers,
-		cfg.KafkaConfig.Topic,
-		cfg.KafkaConfig.GroupID,
-		1,
-		1,
-	)
+	kafkaServ, err := bootstrap.NewKafka(cfg.KafkaConfig, cfg.KafkaConfig.Topic, cfg.KafkaConfig.GroupID)
 	if err != nil {
 		log.Fatalf("failed to initialize kafka: %v", err)
 	}
 	defer kafkaServ.Close()
+	checks.Add("kafka", kafkaServ.Ping)
+
+	dlqServ, err := bootstrap.NewKafka(cfg.KafkaConfig, cfg.KafkaConfig.DLQTopic, "")
+	if err != nil {
+		log.Fatalf("failed to initialize kafka dead-letter topic: %v", err)
+	}
+	defer dlqServ.Close()
 
-	notesServ := notes_serv.NewDefaultService(notes_repo.NewDefaultRepository(db))
-	notifierImpl := notifier.New(bot, notesServ, kafkaServ)
-	notifierImpl.Start()
+	notesServ := notes_serv.NewDefaultService(
+		notes_repo.NewInstrumentedRepository(notes_repo.NewDefaultRepository(db)))
+	outboxServ := outbox_serv.NewDefaultService(outbox_repo.NewDefaultRepository(db), kafkaServ)
+	notifierImpl := notifier.New(bot, notesServ, kafkaServ, dlqServ, outboxServ, cfg.NotifierConfig)
+	notifierImpl.Start(ctx)
 }
@@ -1,93 +1,88 @@
 package main
 
 import (
-	"database/sql"
-	"errors"
-	"fmt"
+	"github.com/kotche/bot/infrastructure/health"
 	"github.com/kotche/bot/infrastructure/metrics"
-	"github.com/kotche/bot/infrastructure/tracing"
 	"github.com/kotche/bot/internal/app/writer"
+	"github.com/kotche/bot/internal/bootstrap"
 	"github.com/kotche/bot/internal/config"
 	notes_repo "github.com/kotche/bot/internal/repository/notes"
+	tokens_repo "github.com/kotche/bot/internal/repository/tokens"
+	dialog_serv "github.com/kotche/bot/internal/service/dialog"
 	notes_serv "github.com/kotche/bot/internal/service/notes"
+	tokens_serv "github.com/kotche/bot/internal/service/tokens"
 	"log"
-	"time"
-
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "time/tzdata"
 
 	"gopkg.in/telebot.v3"
 )
 
-func init() {
-	location, err := time.LoadLocation("Europe/Moscow")
-	if err != nil {
-		log.Fatalf("failed to load location: %v", err)
-	}
-	time.Local = location
-	log.Println("default time zone set to Europe/Moscow")
-}
-
 func main() {
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	metrics.Init()
-	metrics.StartMetricsServer(":8080")
+	if cfg.TelegramConfig.TokenWriteBot == "" || cfg.TelegramConfig.TokenNotifyBot == "" {
+		log.Fatal("TOKEN_WRITE_BOT and TOKEN_NOTIFY_BOT are required, TOKEN_BOT is only for allinone")
+	}
 
-	bot, err := telebot.NewBot(telebot.Settings{
-		Token:  cfg.TelegramConfig.TokenWriteBot,
-		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
-	})
+	ctx, stop := bootstrap.SignalContext(cfg.ShutdownTimeout)
+	defer stop()
+
+	metrics.Init()
+	checks := health.NewChecks()
+	metricsServer := metrics.StartMetricsServer(cfg.HTTPConfig.WriterAddr, cfg.HTTPConfig.Pprof, checks)
+	defer metrics.ShutdownServer(metricsServer, cfg.HTTPConfig.ShutdownTimeout)
 
+	bot, err := bootstrap.NewBot(cfg.TelegramConfig.TokenWriteBot, cfg.TelegramConfig, cfg.TelegramConfig.WriterWebhook, checks)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	connStr := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		cfg.PostgresConfig.User,
-		cfg.PostgresConfig.Password,
-		cfg.PostgresConfig.Host,
-		cfg.PostgresConfig.Port,
-		cfg.PostgresConfig.DBName,
-		cfg.PostgresConfig.SSLMode,
-	)
-	db, err := sql.Open("postgres", connStr)
+	db, err := bootstrap.OpenDB(cfg.PostgresConfig, checks)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal(err)
 	}
+	defer db.Close()
 
-	if err = runMigrations(connStr); err != nil {
+	if err = bootstrap.RunMigrations(cfg.PostgresConfig); err != nil {
 		log.Fatalln("migration error:", err)
 	}
 
-	_, cleanup, err := tracing.InitTracing(cfg.TracingConfig.Endpoint)
+	cleanup, err := bootstrap.InitTracing(cfg.TracingConfig, "writer")
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer cleanup()
 
-	notesServ := notes_serv.NewDefaultService(notes_repo.NewDefaultRepository(db))
-	writerImpl := writer.New(bot, notesServ)
-	writerImpl.Start()
-}
+	dialogRepo, err := bootstrap.DialogRepository(cfg.DialogConfig, db)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func runMigrations(dbURL string) error {
-	m, err := migrate.New(
-		"file://migrations",
-		dbURL,
-	)
+	notesServ := notes_serv.NewDefaultService(
+		notes_repo.NewInstrumentedRepository(notes_repo.NewDefaultRepository(db)))
+	dialogServ := dialog_serv.NewDefaultService(dialogRepo, cfg.DialogConfig.TTL)
+	notifierUsername, err := notifierBotUsername(cfg.TelegramConfig)
 	if err != nil {
-		return fmt.Errorf("failed to init migrations: %w", err)
+		log.Fatalf("failed to resolve notifier bot username: %v", err)
 	}
+	tokensServ := tokens_serv.NewDefaultService(tokens_repo.NewInstrumentedRepository(tokens_repo.NewDefaultRepository(db)))
+	writerImpl := writer.New(bot, notesServ, dialogServ, tokensServ, notifierUsername)
+	writerImpl.Start(ctx)
+}
 
-	if err = m.Up(); !errors.Is(err, migrate.ErrNoChange) && err != nil {
-		return fmt.Errorf("failed to apply migrations: %w", err)
+// notifierBotUsername возвращает имя бота notifier из конфигурации или запрашивает его у telegram
+func notifierBotUsername(cfg config.TelegramConfig) (string, error) {
+	if cfg.NotifyBotUsername != "" {
+		return cfg.NotifyBotUsername, nil
 	}
 
-	return nil
+	// Без поллера: бот notifier обслуживается своим процессом, здесь нужен только getMe
+	notifyBot, err := telebot.NewBot(telebot.Settings{Token: cfg.TokenNotifyBot})
+	if err != nil {
+		return "", err
+	}
+	return notifyBot.Me.Username, nil
 }
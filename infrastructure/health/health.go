@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Check проверка зависимости, nil - зависимость доступна
+type Check func(ctx context.Context) error
+
+// Checks набор проверок готовности, зависимости добавляются по мере инициализации
+type Checks struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readyResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+func NewChecks() *Checks {
+	return &Checks{checks: make(map[string]Check)}
+}
+
+func (c *Checks) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// LiveHandler /healthz: процесс жив и обслуживает http
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// ReadyHandler /readyz: все зависимости доступны, проверки выполняются параллельно
+func (c *Checks) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		c.mu.RLock()
+		checks := make(map[string]Check, len(c.checks))
+		for name, check := range c.checks {
+			checks[name] = check
+		}
+		c.mu.RUnlock()
+
+		var (
+			mu       sync.Mutex
+			wg       sync.WaitGroup
+			response = readyResponse{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+		)
+		for name, check := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				result := checkResult{Status: "ok"}
+				if err := check(ctx); err != nil {
+					result = checkResult{Status: "fail", Error: err.Error()}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				response.Checks[name] = result
+				if result.Status != "ok" {
+					response.Status = "fail"
+				}
+			}()
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		if response.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, response)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("failed to write health response: %v", err)
+	}
+}
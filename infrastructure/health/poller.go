@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/telebot.v3"
+	"sync/atomic"
+)
+
+var ErrPollerStopped = errors.New("telegram poller is not running")
+
+// Poller оборачивает poller telebot и отслеживает, запущен ли он
+type Poller struct {
+	telebot.Poller
+	running atomic.Bool
+}
+
+func NewPoller(poller telebot.Poller) *Poller {
+	return &Poller{Poller: poller}
+}
+
+func (p *Poller) Poll(b *telebot.Bot, updates chan telebot.Update, stop chan struct{}) {
+	p.running.Store(true)
+	defer p.running.Store(false)
+
+	p.Poller.Poll(b, updates, stop)
+}
+
+// Check проверка готовности: poller получает обновления telegram
+func (p *Poller) Check(ctx context.Context) error {
+	if !p.running.Load() {
+		return ErrPollerStopped
+	}
+	return nil
+}
@@ -1,10 +1,17 @@
 package metrics
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/kotche/bot/infrastructure/health"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	httppprof "net/http/pprof"
+	"time"
 )
 
 var (
@@ -16,6 +23,156 @@ var (
 		},
 	)
 
+	NotesClaimedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "notes_claimed_total",
+			Help: "Total number of notes claimed by this notifier instance",
+		},
+	)
+
+	NotesReclaimedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "notes_reclaimed_total",
+			Help: "Total number of notes claimed after the previous owner's lease expired",
+		},
+	)
+
+	ActiveClaimsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "notes_claims_active",
+			Help: "Number of pending notes with an unexpired claim",
+		},
+	)
+
+	ExpiredClaimsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "notes_claims_expired",
+			Help: "Number of pending notes whose claim lease has expired",
+		},
+	)
+
+	ConsumerBatchSizeHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "consumer_batch_size",
+			Help:    "Number of kafka messages in a flushed consumer batch",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		},
+	)
+
+	ConsumerFlushLatencyHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "consumer_flush_latency_seconds",
+			Help:    "Time to write a consumer batch to the database and commit its offsets",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	DeadLetterCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "consumer_dead_letters_total",
+			Help: "Total number of kafka messages sent to the dead-letter topic",
+		},
+	)
+
+	// Метки всех метрик ограничены известными значениями: команды, методы репозитория, топики
+
+	TelegramRequestsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "telegram_requests_total",
+			Help: "Total number of handled telegram updates by command and outcome",
+		},
+		[]string{"command", "outcome"},
+	)
+
+	APIRequestDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_request_duration_seconds",
+			Help:    "REST API request handling time by route, method and status code",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	TelegramRequestDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "telegram_request_duration_seconds",
+			Help:    "Telegram update handling time by command and outcome",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"command", "outcome"},
+	)
+
+	RepositoryQueryDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "repository_query_duration_seconds",
+			Help:    "Repository method duration",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"repository", "method"},
+	)
+
+	RepositoryErrorsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "repository_errors_total",
+			Help: "Total number of failed repository calls, not found is not an error",
+		},
+		[]string{"repository", "method"},
+	)
+
+	KafkaProducedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_messages_produced_total",
+			Help: "Total number of messages sent to kafka by topic and outcome",
+		},
+		[]string{"topic", "outcome"},
+	)
+
+	KafkaConsumedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_messages_consumed_total",
+			Help: "Total number of messages fetched from kafka by topic",
+		},
+		[]string{"topic"},
+	)
+
+	KafkaConsumerLagGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Messages behind the end of the partition after the last fetch",
+		},
+		[]string{"topic"},
+	)
+
+	TelegramRateLimitedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "telegram_rate_limited_total",
+			Help: "Total number of 429 Too Many Requests responses from telegram",
+		},
+	)
+
+	DeliveryPausedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notifier_delivery_paused_total",
+			Help: "Total number of users whose reminders were paused because telegram refused delivery",
+		},
+		[]string{"state"},
+	)
+
+	PendingNotesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "notes_pending",
+			Help: "Number of notes waiting for delivery",
+		},
+	)
+
+	DeliveryDelayHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "notes_delivery_delay_seconds",
+			Help:    "Time between notify_at and the actual telegram send",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 13), // от 1 секунды до ~1 часа
+		},
+	)
+
 	// Объявляем метрику Histogram (для response time показателей)
 	ResponseTimeHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
@@ -30,14 +187,85 @@ func Init() {
 	// Регистрируем метрики
 	prometheus.MustRegister(NotesSentCounter)
 	prometheus.MustRegister(ResponseTimeHistogram)
+	prometheus.MustRegister(NotesClaimedCounter)
+	prometheus.MustRegister(NotesReclaimedCounter)
+	prometheus.MustRegister(ActiveClaimsGauge)
+	prometheus.MustRegister(ExpiredClaimsGauge)
+	prometheus.MustRegister(ConsumerBatchSizeHistogram)
+	prometheus.MustRegister(ConsumerFlushLatencyHistogram)
+	prometheus.MustRegister(DeadLetterCounter)
+	prometheus.MustRegister(TelegramRequestsCounter)
+	prometheus.MustRegister(TelegramRequestDurationHistogram)
+	prometheus.MustRegister(APIRequestDurationHistogram)
+	prometheus.MustRegister(RepositoryQueryDurationHistogram)
+	prometheus.MustRegister(RepositoryErrorsCounter)
+	prometheus.MustRegister(KafkaProducedCounter)
+	prometheus.MustRegister(KafkaConsumedCounter)
+	prometheus.MustRegister(KafkaConsumerLagGauge)
+	prometheus.MustRegister(PendingNotesGauge)
+	prometheus.MustRegister(TelegramRateLimitedCounter)
+	prometheus.MustRegister(DeliveryPausedCounter)
+	prometheus.MustRegister(DeliveryDelayHistogram)
+}
+
+// RegisterDBStats регистрирует метрики пула соединений database/sql
+func RegisterDBStats(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveQuery учитывает длительность вызова метода репозитория и ошибку
+func ObserveQuery(repository, method string, start time.Time, failed bool) {
+	RepositoryQueryDurationHistogram.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	if failed {
+		RepositoryErrorsCounter.WithLabelValues(repository, method).Inc()
+	}
 }
 
-func StartMetricsServer(port string) {
-	http.Handle("/metrics", promhttp.Handler())
+// ObserveProduce учитывает отправку сообщения в kafka
+func ObserveProduce(topic string, err error) {
+	KafkaProducedCounter.WithLabelValues(topic, outcome(err)).Inc()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// StartMetricsServer запускает http сервер с /metrics, /healthz, /readyz и, если pprof, /debug/pprof.
+// Сервер останавливается через Shutdown возвращенного http.Server.
+func StartMetricsServer(addr string, pprof bool, checks *health.Checks) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", health.LiveHandler())
+	mux.Handle("/readyz", checks.ReadyHandler())
+
+	if pprof {
+		mux.HandleFunc("/debug/pprof/", httppprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	}
+
+	server := &http.Server{Addr: addr, Handler: mux}
 	go func() {
-		log.Printf("metrics server running on %s", port)
-		if err := http.ListenAndServe(port, nil); err != nil {
+		log.Printf("metrics server running on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("failed to start metrics server: %v", err)
 		}
 	}()
+
+	return server
+}
+
+// ShutdownServer останавливает http сервер, дожидаясь текущих запросов не дольше timeout
+func ShutdownServer(server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("failed to shutdown metrics server: %v", err)
+	}
 }
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"gopkg.in/telebot.v3"
+	"strings"
+	"time"
+)
+
+// Middleware считает обновления telegram и время их обработки. Метка command - одна из commands,
+// unique кнопки или тип обновления: неизвестные команды не порождают новых значений метки.
+// Кнопки без обработчика до middleware не доходят, поэтому их unique ограничены.
+func Middleware(commands ...string) telebot.MiddlewareFunc {
+	known := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		known[command] = true
+	}
+
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			command := commandLabel(c, known)
+			TelegramRequestsCounter.WithLabelValues(command, outcome(err)).Inc()
+			TelegramRequestDurationHistogram.WithLabelValues(command, outcome(err)).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+func commandLabel(c telebot.Context, known map[string]bool) string {
+	if callback := c.Callback(); callback != nil {
+		return callback.Unique
+	}
+
+	message := c.Message()
+	if message == nil {
+		return "other"
+	}
+	if message.Location != nil {
+		return "location"
+	}
+	if strings.HasPrefix(message.Text, "/") {
+		command, _, _ := strings.Cut(message.Text, " ")
+		command, _, _ = strings.Cut(command, "@")
+		if known[command] {
+			return command
+		}
+		return "unknown_command"
+	}
+	return "text"
+}
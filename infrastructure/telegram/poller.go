@@ -0,0 +1,28 @@
+package telegram
+
+import (
+	"gopkg.in/telebot.v3"
+	"time"
+)
+
+// Значения Options.Mode
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// Options способ получения обновлений бота
+type Options struct {
+	Mode        string
+	PollTimeout time.Duration
+	// Webhook используется в режиме ModeWebhook
+	Webhook WebhookOptions
+}
+
+// NewPoller возвращает источник обновлений бота: long polling или webhook
+func NewPoller(opts Options) telebot.Poller {
+	if opts.Mode == ModeWebhook {
+		return NewWebhook(opts.Webhook)
+	}
+	return &telebot.LongPoller{Timeout: opts.PollTimeout}
+}
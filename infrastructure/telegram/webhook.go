@@ -0,0 +1,130 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/telebot.v3"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	// maxUpdateSize ограничение тела запроса, обновления telegram намного меньше
+	maxUpdateSize = 1 << 20
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// Webhook принимает обновления telegram по HTTP и передает их в те же обработчики, что и long polling.
+// В отличие от telebot.Webhook отвечает 401 на неверный секрет и 400 на некорректное тело.
+//
+// Secret обязателен. Без PublicURL webhook в telegram не регистрируется, обновления можно отправить вручную:
+//
+//	curl -H 'X-Telegram-Bot-Api-Secret-Token: secret' -d @update.json http://localhost:8443/
+type Webhook struct {
+	opts WebhookOptions
+
+	dest chan<- telebot.Update
+	stop <-chan struct{}
+}
+
+// WebhookOptions адрес и секрет webhook-сервера
+type WebhookOptions struct {
+	// Addr адрес, на котором слушает webhook-сервер
+	Addr string
+	// PublicURL адрес, который регистрируется в telegram. Если пустой, webhook не регистрируется
+	PublicURL string
+	// Secret сверяется с заголовком X-Telegram-Bot-Api-Secret-Token, обязателен
+	Secret string
+	// TLSCert и TLSKey пути к сертификату и ключу, без них сервер слушает HTTP
+	TLSCert string
+	TLSKey  string
+}
+
+func NewWebhook(opts WebhookOptions) *Webhook {
+	return &Webhook{opts: opts}
+}
+
+// SetWebhook регистрирует PublicURL в telegram, без PublicURL ничего не делает.
+// Вызывается при запуске, до bot.Start: Poll не может вернуть ошибку.
+func SetWebhook(b *telebot.Bot, opts WebhookOptions) error {
+	if opts.PublicURL == "" {
+		return nil
+	}
+
+	err := b.SetWebhook(&telebot.Webhook{
+		SecretToken: opts.Secret,
+		Endpoint:    &telebot.WebhookEndpoint{PublicURL: opts.PublicURL},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set webhook '%s': %w", opts.PublicURL, err)
+	}
+	return nil
+}
+
+// Poll обслуживает HTTP-сервер до остановки бота, webhook регистрируется заранее через SetWebhook
+func (w *Webhook) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	w.dest = dest
+	w.stop = stop
+
+	server := &http.Server{
+		Addr:              w.opts.Addr,
+		Handler:           w,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		if w.opts.TLSCert != "" {
+			served <- server.ListenAndServeTLS(w.opts.TLSCert, w.opts.TLSKey)
+		} else {
+			served <- server.ListenAndServe()
+		}
+	}()
+	log.Printf("webhook listening on %s", w.opts.Addr)
+
+	select {
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("failed to shutdown webhook server: %v", err)
+		}
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("webhook server error: %v", err)
+		}
+	}
+}
+
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretHeader)), []byte(w.opts.Secret)) != 1 {
+		http.Error(rw, "invalid secret token", http.StatusUnauthorized)
+		return
+	}
+
+	var update telebot.Update
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxUpdateSize)).Decode(&update); err != nil {
+		http.Error(rw, fmt.Sprintf("cannot decode update: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Обновление не принято: бот останавливается или запрос отменен. Telegram повторит запрос
+	// только на ответ с ошибкой, поэтому в обоих случаях отвечаем 503.
+	select {
+	case w.dest <- update:
+	case <-w.stop:
+		http.Error(rw, "bot is stopping", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+		http.Error(rw, "update not accepted", http.StatusServiceUnavailable)
+	}
+}
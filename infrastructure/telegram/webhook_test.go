@@ -0,0 +1,102 @@
+package telegram
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/telebot.v3"
+)
+
+const testSecret = "secret"
+
+// newTestWebhook webhook, который передает обновления в dest, как после Poll
+func newTestWebhook(dest chan telebot.Update, stop chan struct{}) *Webhook {
+	w := NewWebhook(WebhookOptions{Secret: testSecret})
+	w.dest = dest
+	w.stop = stop
+	return w
+}
+
+func post(ctx context.Context, w *Webhook, method, secret, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/", strings.NewReader(body)).WithContext(ctx)
+	if secret != "" {
+		request.Header.Set(secretHeader, secret)
+	}
+	recorder := httptest.NewRecorder()
+	w.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestWebhookDispatchesUpdate(t *testing.T) {
+	dest := make(chan telebot.Update, 1)
+	w := newTestWebhook(dest, make(chan struct{}))
+
+	recorder := post(context.Background(), w, http.MethodPost, testSecret, `{"update_id": 42, "message": {"text": "/start"}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	select {
+	case update := <-dest:
+		if update.ID != 42 || update.Message == nil || update.Message.Text != "/start" {
+			t.Fatalf("unexpected update %+v", update)
+		}
+	default:
+		t.Fatal("update was not dispatched")
+	}
+}
+
+func TestWebhookRejectsRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		want   int
+	}{
+		{name: "method", method: http.MethodGet, secret: testSecret, want: http.StatusMethodNotAllowed},
+		{name: "missing secret", method: http.MethodPost, body: `{"update_id": 1}`, want: http.StatusUnauthorized},
+		{name: "wrong secret", method: http.MethodPost, secret: "wrong", body: `{"update_id": 1}`, want: http.StatusUnauthorized},
+		{name: "bad body", method: http.MethodPost, secret: testSecret, body: `{"update_id":`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := make(chan telebot.Update, 1)
+			w := newTestWebhook(dest, make(chan struct{}))
+
+			recorder := post(context.Background(), w, tt.method, tt.secret, tt.body)
+			if recorder.Code != tt.want {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if len(dest) != 0 {
+				t.Fatal("rejected update was dispatched")
+			}
+		})
+	}
+}
+
+func TestWebhookStopping(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+	// Обновления никто не читает
+	w := newTestWebhook(make(chan telebot.Update), stop)
+
+	recorder := post(context.Background(), w, http.MethodPost, testSecret, `{"update_id": 1}`)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", recorder.Code)
+	}
+}
+
+func TestWebhookCanceledRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := newTestWebhook(make(chan telebot.Update), make(chan struct{}))
+
+	recorder := post(ctx, w, http.MethodPost, testSecret, `{"update_id": 1}`)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", recorder.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"os"
+)
+
+// Значения TRACING_EXPORTER
+const (
+	ExporterJaeger   = "jaeger"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	ExporterFile     = "file"
+	ExporterNone     = "none"
+)
+
+// newExporter создает экспортер спанов. Вторым значением возвращается закрытие файла для file, иначе no-op.
+// Пустой Endpoint для OTLP означает адрес по умолчанию или из OTEL_EXPORTER_OTLP_ENDPOINT.
+func newExporter(opts Options) (sdktrace.SpanExporter, func() error, error) {
+	noop := func() error { return nil }
+
+	switch opts.Exporter {
+	case ExporterJaeger:
+		exporter, err := jaeger.New(
+			jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(opts.Endpoint)),
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to init jaeger exporter: %w", err)
+		}
+		return exporter, noop, nil
+	case ExporterOTLPGRPC:
+		var grpcOpts []otlptracegrpc.Option
+		if opts.Endpoint != "" {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(context.Background(), grpcOpts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to init otlp grpc exporter: %w", err)
+		}
+		return exporter, noop, nil
+	case ExporterOTLPHTTP:
+		var httpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(context.Background(), httpOpts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to init otlp http exporter: %w", err)
+		}
+		return exporter, noop, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to init stdout exporter: %w", err)
+		}
+		return exporter, noop, nil
+	case ExporterFile:
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open tracing file '%s': %w", opts.File, err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to init file exporter: %w", err)
+		}
+		return exporter, file.Close, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown tracing exporter '%s'", opts.Exporter)
+}
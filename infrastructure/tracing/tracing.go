@@ -4,32 +4,80 @@ import (
 	"context"
 	"fmt"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/telebot.v3"
 	"log"
+	"strings"
 )
 
 const (
 	nameTracer = "note-tracer"
+
+	// contextKey ключ контекста трассировки в telebot.Context
+	contextKey = "tracing_ctx"
 )
 
+// Options экспортер и сэмплирование трасс
+type Options struct {
+	// Exporter одно из значений Exporter*
+	Exporter string
+	// Endpoint адрес коллектора, для otlp пустой - адрес по умолчанию
+	Endpoint string
+	Insecure bool
+	// File файл для экспортера file
+	File string
+	// SampleRatio доля сохраняемых трасс от 0 до 1
+	SampleRatio float64
+	// ParentBased сэмплировать по решению родительского спана, если он есть
+	ParentBased    bool
+	ServiceVersion string
+}
+
 type TracerWrapper struct {
 	Tracer trace.Tracer
 }
 
-func InitTracing(endpoint string) (trace.Tracer, func(), error) {
-	exporter, err := jaeger.New(
-		jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(endpoint)),
-	)
+// InitTracing настраивает глобальный провайдер трассировки с экспортером и сэмплером из opts.
+// serviceName отличает writer и notifier в бэкенде трассировки.
+func InitTracing(opts Options, serviceName string) (trace.Tracer, func(), error) {
+	// W3C Trace Context для передачи трассировки через заголовки kafka
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	if opts.Exporter == ExporterNone {
+		return otel.Tracer(nameTracer), func() {}, nil
+	}
+
+	exporter, closeOutput, err := newExporter(opts)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to init jaeger exporter: %w", err)
+		return nil, nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(opts.ServiceVersion),
+	))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	sampler := sdktrace.TraceIDRatioBased(opts.SampleRatio)
+	if opts.ParentBased {
+		// Решение вызывающей стороны (например, из заголовков kafka) важнее собственного
+		sampler = sdktrace.ParentBased(sampler)
 	}
 
 	tp := sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.Default()),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
 	)
 
 	otel.SetTracerProvider(tp)
@@ -38,11 +86,62 @@ func InitTracing(endpoint string) (trace.Tracer, func(), error) {
 		if err = tp.Shutdown(context.Background()); err != nil {
 			log.Printf("failed to shutdown tracer provider: %v", err)
 		}
+		if err = closeOutput(); err != nil {
+			log.Printf("failed to close tracing output: %v", err)
+		}
 	}
 
 	return otel.Tracer(nameTracer), cleanup, nil
 }
 
-func StartSpan(ctx context.Context, spanName string) (context.Context, trace.Span) {
-	return otel.Tracer(nameTracer).Start(ctx, spanName)
+func StartSpan(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(nameTracer).Start(ctx, spanName, opts...)
+}
+
+// Middleware открывает span на каждое обновление telegram: команду, текст или нажатие кнопки
+func Middleware(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx, span := StartSpan(context.Background(), updateName(c))
+		defer span.End()
+
+		if sender := c.Sender(); sender != nil {
+			span.SetAttributes(attribute.Int64("telegram.user_id", sender.ID))
+		}
+		if chat := c.Chat(); chat != nil {
+			span.SetAttributes(attribute.Int64("telegram.chat_id", chat.ID))
+		}
+
+		c.Set(contextKey, ctx)
+		err := next(c)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// Context возвращает контекст со span обновления, открытым Middleware
+func Context(c telebot.Context) context.Context {
+	if ctx, ok := c.Get(contextKey).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+func updateName(c telebot.Context) string {
+	if callback := c.Callback(); callback != nil {
+		return "telegram callback " + callback.Unique
+	}
+	if message := c.Message(); message != nil {
+		if text := message.Text; strings.HasPrefix(text, "/") {
+			command, _, _ := strings.Cut(text, " ")
+			command, _, _ = strings.Cut(command, "@")
+			return "telegram " + command
+		}
+		if message.Location != nil {
+			return "telegram location"
+		}
+	}
+	return "telegram text"
 }
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/kotche/bot/internal/config"
+	"github.com/kotche/bot/internal/service/notes"
+	"github.com/kotche/bot/internal/service/tokens"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+
+	defaultPageSize = 50
+	maxPageSize     = 200
+	// maxBodySize ограничение тела запроса
+	maxBodySize = 64 << 10
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// API REST API заметок и пользователей поверх notes.Service.
+// Пользователь аутентифицируется токеном, выпущенным командой /token бота writer.
+type API struct {
+	notes  notes.Service
+	tokens tokens.Service
+	cfg    config.APIConfig
+}
+
+func New(notes notes.Service, tokens tokens.Service, cfg config.APIConfig) *API {
+	return &API{notes: notes, tokens: tokens, cfg: cfg}
+}
+
+// Handler возвращает маршруты API с трассировкой и метриками
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /openapi.yaml", a.openAPI)
+
+	mux.Handle("GET /api/v1/me", a.authenticate(a.getMe))
+	mux.Handle("PATCH /api/v1/me", a.authenticate(a.updateMe))
+
+	mux.Handle("GET /api/v1/notes", a.authenticate(a.listNotes))
+	mux.Handle("POST /api/v1/notes", a.authenticate(a.createNote))
+	mux.Handle("GET /api/v1/notes/{id}", a.authenticate(a.getNote))
+	mux.Handle("PATCH /api/v1/notes/{id}", a.authenticate(a.updateNote))
+	mux.Handle("DELETE /api/v1/notes/{id}", a.authenticate(a.deleteNote))
+
+	return instrument(mux)
+}
+
+// Start обслуживает API до отмены ctx, после отмены дожидается текущих запросов не дольше shutdownTimeout
+func (a *API) Start(ctx context.Context, shutdownTimeout time.Duration) {
+	server := &http.Server{
+		Addr:              a.cfg.Addr,
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Println("api stopping...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("failed to shutdown api server: %v", err)
+		}
+	}()
+
+	log.Printf("api started on %s...", a.cfg.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("api server error: %v", err)
+	}
+	log.Println("api stopped")
+}
+
+func (a *API) openAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openAPISpec)
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kotche/bot/internal/config"
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/service/notes"
+	"github.com/kotche/bot/internal/service/tokens"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testToken  = "test-token"
+	testUserID = model.UserID(7)
+)
+
+// fakeNotes хранит заметки одного пользователя, отбирает их как ListNotesPage и запоминает вызовы
+type fakeNotes struct {
+	notes.Service
+
+	notes   []model.Note
+	filters []model.NoteFilter
+	patches []model.NotePatch
+	// patchErr возвращается из Patch
+	patchErr error
+}
+
+func (f *fakeNotes) ListPage(_ context.Context, _ model.UserID, filter model.NoteFilter) ([]model.Note, error) {
+	f.filters = append(f.filters, filter)
+
+	var page []model.Note
+	for _, note := range f.notes {
+		if note.ID <= filter.AfterID || (filter.Status != "" && note.Status != filter.Status) {
+			continue
+		}
+		if filter.Deleted != nil && (note.DeletedAt != nil) != *filter.Deleted {
+			continue
+		}
+		if len(page) == filter.Limit {
+			break
+		}
+		page = append(page, note)
+	}
+	return page, nil
+}
+
+func (f *fakeNotes) Get(_ context.Context, noteID model.NoteID, _ model.UserID) (*model.Note, error) {
+	for _, note := range f.notes {
+		if note.ID == noteID {
+			return &note, nil
+		}
+	}
+	return nil, model.ErrNoteNotFound
+}
+
+func (f *fakeNotes) Patch(_ context.Context, _ model.NoteID, _ model.UserID, patch model.NotePatch) error {
+	f.patches = append(f.patches, patch)
+	return f.patchErr
+}
+
+type fakeTokens struct {
+	tokens.Service
+}
+
+func (fakeTokens) Authenticate(_ context.Context, token string) (model.UserID, error) {
+	if token != testToken {
+		return 0, model.ErrInvalidToken
+	}
+	return testUserID, nil
+}
+
+func newTestAPI(notes []model.Note) (*fakeNotes, http.Handler) {
+	fake := &fakeNotes{notes: notes}
+	return fake, New(fake, fakeTokens{}, config.APIConfig{}).Handler()
+}
+
+func pendingNotes(count int) []model.Note {
+	notes := make([]model.Note, 0, count)
+	for i := 1; i <= count; i++ {
+		notes = append(notes, model.Note{ID: model.NoteID(i), UserID: testUserID, Status: model.NoteStatusPending})
+	}
+	return notes
+}
+
+func do(t *testing.T, handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decodePage(t *testing.T, recorder *httptest.ResponseRecorder) notesPage {
+	t.Helper()
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	var page notesPage
+	if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func pageIDs(page notesPage) []model.NoteID {
+	ids := make([]model.NoteID, 0, len(page.Notes))
+	for _, note := range page.Notes {
+		ids = append(ids, note.ID)
+	}
+	return ids
+}
+
+func TestListNotesPaginates(t *testing.T) {
+	fake, handler := newTestAPI(pendingNotes(5))
+
+	var (
+		got    [][]model.NoteID
+		cursor string
+	)
+	for range 4 {
+		page := decodePage(t, do(t, handler, http.MethodGet, "/api/v1/notes?limit=2&cursor="+cursor, ""))
+		got = append(got, pageIDs(page))
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := [][]model.NoteID{{1, 2}, {3, 4}, {5}}
+	if !slices.EqualFunc(got, want, slices.Equal[[]model.NoteID]) {
+		t.Fatalf("pages = %v, want %v", got, want)
+	}
+
+	// Сервис запрашивает на одну заметку больше, чтобы узнать о следующей странице
+	for _, filter := range fake.filters {
+		if filter.Limit != 3 {
+			t.Fatalf("service limit = %d, want 3", filter.Limit)
+		}
+	}
+	if fake.filters[1].AfterID != 2 || fake.filters[2].AfterID != 4 {
+		t.Fatalf("cursors = %d, %d, want 2, 4", fake.filters[1].AfterID, fake.filters[2].AfterID)
+	}
+}
+
+func TestListNotesFullLastPageHasNoCursor(t *testing.T) {
+	_, handler := newTestAPI(pendingNotes(2))
+
+	page := decodePage(t, do(t, handler, http.MethodGet, "/api/v1/notes?limit=2", ""))
+	if len(page.Notes) != 2 || page.NextCursor != "" {
+		t.Fatalf("notes = %v, cursor = %q, want 2 notes without cursor", pageIDs(page), page.NextCursor)
+	}
+}
+
+func TestListNotesDefaultFilter(t *testing.T) {
+	fake, handler := newTestAPI(nil)
+
+	page := decodePage(t, do(t, handler, http.MethodGet, "/api/v1/notes", ""))
+	if page.Notes == nil || len(page.Notes) != 0 {
+		t.Fatalf("notes = %v, want empty list", page.Notes)
+	}
+
+	filter := fake.filters[0]
+	if filter.Limit != defaultPageSize+1 || filter.AfterID != 0 || filter.Status != "" {
+		t.Fatalf("filter = %+v", filter)
+	}
+	if filter.Deleted == nil || *filter.Deleted {
+		t.Fatal("deleted notes must be excluded by default")
+	}
+}
+
+func TestListNotesFilters(t *testing.T) {
+	deletedAt := time.Now()
+	notes := []model.Note{
+		{ID: 1, Status: model.NoteStatusPending},
+		{ID: 2, Status: model.NoteStatusSent},
+		{ID: 3, Status: model.NoteStatusCancelled, DeletedAt: &deletedAt},
+		{ID: 4, Status: model.NoteStatusSent},
+	}
+
+	tests := []struct {
+		query string
+		want  []model.NoteID
+	}{
+		{query: "status=sent", want: []model.NoteID{2, 4}},
+		{query: "deleted=true", want: []model.NoteID{3}},
+		{query: "deleted=any", want: []model.NoteID{1, 2, 3, 4}},
+		{query: "status=sent&cursor=2", want: []model.NoteID{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, handler := newTestAPI(notes)
+
+			got := pageIDs(decodePage(t, do(t, handler, http.MethodGet, "/api/v1/notes?"+tt.query, "")))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("notes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListNotesRejectsInvalidQuery(t *testing.T) {
+	for _, query := range []string{
+		"limit=0", "limit=201", "limit=ten", "cursor=-1", "cursor=abc", "status=unknown", "deleted=maybe",
+	} {
+		t.Run(query, func(t *testing.T) {
+			fake, handler := newTestAPI(pendingNotes(1))
+
+			recorder := do(t, handler, http.MethodGet, "/api/v1/notes?"+query, "")
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", recorder.Code)
+			}
+			if len(fake.filters) != 0 {
+				t.Fatal("service must not be called for an invalid query")
+			}
+		})
+	}
+}
+
+func TestListNotesRequiresToken(t *testing.T) {
+	fake, handler := newTestAPI(pendingNotes(1))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/notes", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", recorder.Code)
+	}
+	if len(fake.filters) != 0 {
+		t.Fatal("service must not be called without a token")
+	}
+}
+
+func TestUpdateNoteValidatesBeforeWriting(t *testing.T) {
+	for _, body := range []string{
+		`{"text": "new text", "recurrence": "not a rule"}`,
+		`{"text": " ", "recurrence": "daily 09:00"}`,
+		`{"text": "new text", "notify_at": "2000-01-01T00:00:00Z"}`,
+	} {
+		t.Run(body, func(t *testing.T) {
+			fake, handler := newTestAPI(pendingNotes(1))
+
+			recorder := do(t, handler, http.MethodPatch, "/api/v1/notes/1", body)
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", recorder.Code, recorder.Body)
+			}
+			if len(fake.patches) != 0 {
+				t.Fatalf("note changed despite invalid request: %+v", fake.patches)
+			}
+		})
+	}
+}
+
+func TestUpdateNotePatchesOnce(t *testing.T) {
+	fake, handler := newTestAPI(pendingNotes(1))
+
+	recorder := do(t, handler, http.MethodPatch, "/api/v1/notes/1", `{"text": "new text", "recurrence": "ежедневно 09:00"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	if len(fake.patches) != 1 {
+		t.Fatalf("patches = %d, want 1", len(fake.patches))
+	}
+
+	patch := fake.patches[0]
+	if patch.Text == nil || *patch.Text != "new text" || patch.NotifyAt != nil {
+		t.Fatalf("patch = %+v", patch)
+	}
+	if patch.Recurrence == nil || *patch.Recurrence != "daily 09:00" {
+		t.Fatalf("recurrence = %v, want canonical daily 09:00", patch.Recurrence)
+	}
+}
+
+func TestUpdateNoteErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: model.ErrNoteNotPending, want: http.StatusConflict},
+		{err: model.ErrNoteNotFound, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			fake, handler := newTestAPI(pendingNotes(1))
+			fake.patchErr = tt.err
+
+			recorder := do(t, handler, http.MethodPatch, "/api/v1/notes/1", `{"recurrence": "daily 09:00"}`)
+			if recorder.Code != tt.want {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.want, recorder.Body)
+			}
+		})
+	}
+}
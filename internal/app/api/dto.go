@@ -0,0 +1,79 @@
+package api
+
+import (
+	"github.com/kotche/bot/internal/model"
+	"time"
+)
+
+type (
+	userResponse struct {
+		ID            model.UserID        `json:"id"`
+		Login         string              `json:"login"`
+		Timezone      string              `json:"timezone"`
+		DeliveryState model.DeliveryState `json:"delivery_state"`
+	}
+
+	updateUserRequest struct {
+		Timezone *string `json:"timezone"`
+	}
+
+	noteResponse struct {
+		ID             model.NoteID     `json:"id"`
+		Text           string           `json:"text"`
+		NotifyAt       time.Time        `json:"notify_at"`
+		Recurrence     string           `json:"recurrence,omitempty"`
+		Status         model.NoteStatus `json:"status"`
+		SentAt         *time.Time       `json:"sent_at,omitempty"`
+		Attempts       int              `json:"attempts"`
+		CreatedAt      time.Time        `json:"created_at"`
+		DeletedAt      *time.Time       `json:"deleted_at,omitempty"`
+		AcknowledgedAt *time.Time       `json:"acknowledged_at,omitempty"`
+	}
+
+	notesPage struct {
+		Notes []noteResponse `json:"notes"`
+		// NextCursor передается в cursor для следующей страницы, пустой на последней странице
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+
+	createNoteRequest struct {
+		Text       string    `json:"text"`
+		NotifyAt   time.Time `json:"notify_at"`
+		Recurrence string    `json:"recurrence"`
+	}
+
+	// updateNoteRequest изменяет только переданные поля, пустое recurrence отключает повторение
+	updateNoteRequest struct {
+		Text       *string    `json:"text"`
+		NotifyAt   *time.Time `json:"notify_at"`
+		Recurrence *string    `json:"recurrence"`
+	}
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+func newUserResponse(user model.User) userResponse {
+	return userResponse{
+		ID:            user.ID,
+		Login:         user.Login,
+		Timezone:      user.Timezone,
+		DeliveryState: user.DeliveryState,
+	}
+}
+
+func newNoteResponse(note model.Note) noteResponse {
+	return noteResponse{
+		ID:             note.ID,
+		Text:           note.Text,
+		NotifyAt:       note.NotifyAt,
+		Recurrence:     note.Recurrence,
+		Status:         note.Status,
+		SentAt:         note.SentAt,
+		Attempts:       note.Attempts,
+		CreatedAt:      note.CreatedAt,
+		DeletedAt:      note.DeletedAt,
+		AcknowledgedAt: note.AcknowledgedAt,
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/recurrence"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (a *API) getMe(w http.ResponseWriter, r *http.Request) {
+	user, err := a.notes.GetUser(r.Context(), userID(r))
+	if err != nil {
+		a.handleError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(*user))
+}
+
+func (a *API) updateMe(w http.ResponseWriter, r *http.Request) {
+	var request updateUserRequest
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	if request.Timezone != nil {
+		user, err := a.notes.GetUser(r.Context(), userID(r))
+		if err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+		if err = a.notes.SetTimezone(r.Context(), *user, *request.Timezone); err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+	}
+
+	a.getMe(w, r)
+}
+
+// listNotes страница заметок: ?status=pending&deleted=false&limit=50&cursor={next_cursor}.
+// deleted: false (по умолчанию) - без удаленных, true - только удаленные, any - все.
+func (a *API) listNotes(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseNoteFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Лишняя заметка показывает, что есть следующая страница
+	limit := filter.Limit
+	filter.Limit++
+
+	notes, err := a.notes.ListPage(r.Context(), userID(r), filter)
+	if err != nil {
+		a.handleError(w, r, err)
+		return
+	}
+
+	page := notesPage{Notes: make([]noteResponse, 0, len(notes))}
+	if len(notes) > limit {
+		notes = notes[:limit]
+		page.NextCursor = strconv.FormatInt(int64(notes[limit-1].ID), 10)
+	}
+	for _, note := range notes {
+		page.Notes = append(page.Notes, newNoteResponse(note))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (a *API) createNote(w http.ResponseWriter, r *http.Request) {
+	var request createNoteRequest
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	if strings.TrimSpace(request.Text) == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	if !request.NotifyAt.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, "notify_at must be in the future")
+		return
+	}
+	rule, err := parseRecurrence(request.Recurrence)
+	if err != nil {
+		a.handleError(w, r, err)
+		return
+	}
+
+	noteID, err := a.notes.Create(r.Context(), model.Note{
+		UserID:     userID(r),
+		Text:       request.Text,
+		NotifyAt:   request.NotifyAt,
+		Recurrence: rule,
+	})
+	if err != nil {
+		a.handleError(w, r, err)
+		return
+	}
+
+	a.writeNote(w, r, noteID, http.StatusCreated)
+}
+
+func (a *API) getNote(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := parseNoteID(w, r)
+	if !ok {
+		return
+	}
+
+	a.writeNote(w, r, noteID, http.StatusOK)
+}
+
+// updateNote проверяет все переданные поля и только потом меняет заметку одним вызовом
+func (a *API) updateNote(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := parseNoteID(w, r)
+	if !ok {
+		return
+	}
+
+	var request updateNoteRequest
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	patch := model.NotePatch{Text: request.Text, NotifyAt: request.NotifyAt}
+	if request.Text != nil && strings.TrimSpace(*request.Text) == "" {
+		writeError(w, http.StatusBadRequest, "text must not be empty")
+		return
+	}
+	if request.NotifyAt != nil && !request.NotifyAt.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, "notify_at must be in the future")
+		return
+	}
+	if request.Recurrence != nil {
+		rule, err := parseRecurrence(*request.Recurrence)
+		if err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+		patch.Recurrence = &rule
+	}
+
+	if err := a.notes.Patch(r.Context(), noteID, userID(r), patch); err != nil {
+		a.handleError(w, r, err)
+		return
+	}
+
+	a.writeNote(w, r, noteID, http.StatusOK)
+}
+
+func (a *API) deleteNote(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := parseNoteID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.notes.Delete(r.Context(), noteID, userID(r)); err != nil {
+		a.handleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) writeNote(w http.ResponseWriter, r *http.Request, noteID model.NoteID, code int) {
+	note, err := a.notes.Get(r.Context(), noteID, userID(r))
+	if err != nil {
+		a.handleError(w, r, err)
+		return
+	}
+
+	writeJSON(w, code, newNoteResponse(*note))
+}
+
+// handleError переводит ошибки сервисов в коды ответа, неизвестные ошибки логируются и скрываются от клиента
+func (a *API) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, model.ErrInvalidToken):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, model.ErrNoteNotFound), errors.Is(err, model.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, model.ErrInvalidTimezone), errors.Is(err, recurrence.ErrInvalidRule):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, model.ErrNoteNotPending):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("api %s %s failed: %v", r.Method, r.URL.Path, err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func parseNoteFilter(r *http.Request) (model.NoteFilter, error) {
+	query := r.URL.Query()
+	filter := model.NoteFilter{Limit: defaultPageSize}
+
+	if status := query.Get("status"); status != "" {
+		switch model.NoteStatus(status) {
+		case model.NoteStatusPending, model.NoteStatusSent, model.NoteStatusAcknowledged,
+			model.NoteStatusCancelled, model.NoteStatusFailed:
+			filter.Status = model.NoteStatus(status)
+		default:
+			return filter, fmt.Errorf("unknown status '%s'", status)
+		}
+	}
+
+	switch deleted := query.Get("deleted"); deleted {
+	case "", "false":
+		filter.Deleted = new(bool)
+	case "true":
+		filter.Deleted = new(bool)
+		*filter.Deleted = true
+	case "any":
+	default:
+		return filter, fmt.Errorf("deleted must be true, false or any")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		filter.Limit = value
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		value, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || value < 0 {
+			return filter, fmt.Errorf("invalid cursor '%s'", cursor)
+		}
+		filter.AfterID = model.NoteID(value)
+	}
+
+	return filter, nil
+}
+
+// parseRecurrence возвращает каноническую форму правила повторения, пустое правило - без повторения
+func parseRecurrence(input string) (string, error) {
+	if input == "" {
+		return "", nil
+	}
+	rule, err := recurrence.Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
+
+func parseNoteID(w http.ResponseWriter, r *http.Request) (model.NoteID, bool) {
+	noteID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid note id '%s'", r.PathValue("id")))
+		return 0, false
+	}
+	return model.NoteID(noteID), true
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write api response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, errorResponse{Error: message})
+}
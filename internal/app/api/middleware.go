@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+// statusRecorder запоминает код ответа для метрик и трассировки
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// instrument открывает span на запрос, продолжая трассировку из заголовка traceparent, и пишет метрики
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.StartSpan(ctx, "api "+r.Method)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		r = r.WithContext(ctx)
+		mux.ServeHTTP(recorder, r)
+
+		// Маршрут известен только после выбора обработчика, ServeMux записывает его в r.Pattern
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		} else if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		span.SetName("api " + r.Method + " " + route)
+		span.SetAttributes(attribute.Int("http.status_code", recorder.code))
+		if recorder.code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.code))
+		}
+
+		metrics.APIRequestDurationHistogram.
+			WithLabelValues(route, r.Method, strconv.Itoa(recorder.code)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// authenticate пропускает запрос с действующим токеном в заголовке Authorization: Bearer
+func (a *API) authenticate(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		userID, err := a.tokens.Authenticate(ctx, strings.TrimSpace(token))
+		if err != nil {
+			a.handleError(w, r, err)
+			return
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("api.user_id", int64(userID)))
+		next(w, r.WithContext(context.WithValue(ctx, contextKey{}, userID)))
+	})
+}
+
+// userID возвращает пользователя, аутентифицированного authenticate
+func userID(r *http.Request) model.UserID {
+	userID, _ := r.Context().Value(contextKey{}).(model.UserID)
+	return userID
+}
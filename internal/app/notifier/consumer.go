@@ -0,0 +1,223 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/service/kafka"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"time"
+)
+
+// runMarkSentNotes читает из kafka доставленные напоминания и переводит разовые в статус sent.
+// Сообщения копятся до ConsumerBatchSize штук или ConsumerFlushInterval с первого сообщения партии,
+// offset коммитится только после записи в БД или в dead-letter топик.
+// Обработка идемпотентна: статус уже выставлен при доставке, повторное сообщение ничего не меняет.
+func (n *Notifier) runMarkSentNotes(ctx context.Context) error {
+	for {
+		batch, err := n.fetchBatch(ctx)
+		if len(batch) > 0 {
+			// При остановке собранная партия все равно записывается и коммитится, но не дольше FlushTimeout
+			flushCtx, cancel := n.flushContext(ctx)
+			flushErr := n.flushSentBatch(flushCtx, batch)
+			cancel()
+			if flushErr != nil {
+				return flushErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flushContext не отменяется вместе с ctx, а истекает через FlushTimeout после его отмены
+func (n *Notifier) flushContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	flushCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(n.cfg.FlushTimeout, cancel)
+	})
+	return flushCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// fetchBatch собирает партию сообщений. Ошибка возвращается только при отмене ctx.
+func (n *Notifier) fetchBatch(ctx context.Context) ([]kafka.Message, error) {
+	batch := make([]kafka.Message, 0, n.cfg.ConsumerBatchSize)
+
+	fetchCtx := ctx
+	delay := retryDelay
+	for len(batch) < n.cfg.ConsumerBatchSize {
+		msg, err := n.broker.FetchMessage(fetchCtx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return batch, ctx.Err()
+			}
+			// Истекло время ожидания партии
+			if fetchCtx.Err() != nil {
+				break
+			}
+			log.Printf("error reading message from kafka, retry in %s: %v", delay, err)
+			if err = sleep(fetchCtx, delay); err != nil {
+				if ctx.Err() != nil {
+					return batch, ctx.Err()
+				}
+				break
+			}
+			delay = min(delay*2, maxRetryDelay)
+			continue
+		}
+		delay = retryDelay
+
+		// Отсчет времени партии начинается с первого сообщения
+		if len(batch) == 0 {
+			var cancel context.CancelFunc
+			fetchCtx, cancel = context.WithTimeout(ctx, n.cfg.ConsumerFlushInterval)
+			defer cancel()
+		}
+		batch = append(batch, msg)
+	}
+
+	return batch, nil
+}
+
+// flushSentBatch отмечает заметки партии отправленными и коммитит offset.
+// Ошибка БД повторяется с задержкой ConsumerMaxRetries раз, после этого заметки обрабатываются
+// по одной, и сообщения, которые так и не удалось обработать, уходят в dead-letter топик.
+//
+// Span каждого сообщения продолжает трассировку доставки напоминания и открыт до коммита партии.
+// Запись в БД и коммит идут в span партии, связанном со span'ами всех ее сообщений.
+func (n *Notifier) flushSentBatch(ctx context.Context, batch []kafka.Message) (err error) {
+	startTime := time.Now()
+
+	msgs := make([]kafka.Message, 0, len(batch))
+	refs := make([]model.NoteRef, 0, len(batch))
+	spans := make([]trace.Span, 0, len(batch))
+	defer func() {
+		for _, span := range spans {
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}()
+	for _, msg := range batch {
+		event, err := kafka.DecodeEvent(msg.Key, msg.Value)
+		if err != nil {
+			if err = n.deadLetter(ctx, msg, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if event.Type != kafka.EventNoteDelivered {
+			continue
+		}
+
+		_, span := tracing.StartSpan(msg.Context(ctx), "MarkSent_consumer")
+		span.SetAttributes(attribute.Int64("note.id", int64(event.NoteID)), attribute.Int64("note.user_id", int64(event.UserID)))
+		spans = append(spans, span)
+
+		msgs = append(msgs, msg)
+		refs = append(refs, model.NoteRef{ID: event.NoteID, UserID: event.UserID})
+	}
+
+	links := make([]trace.Link, 0, len(spans))
+	for _, span := range spans {
+		links = append(links, trace.Link{SpanContext: span.SpanContext()})
+	}
+	ctx, batchSpan := tracing.StartSpan(ctx, "MarkSentBatch_consumer", trace.WithLinks(links...))
+	batchSpan.SetAttributes(attribute.Int("batch.size", len(batch)), attribute.Int("batch.delivered", len(refs)))
+	defer batchSpan.End()
+
+	err = withRetry(ctx, n.cfg.ConsumerMaxRetries, func() error {
+		marked, err := n.notes.MarkSent(ctx, refs)
+		if err == nil {
+			log.Printf("%d of %d notes marked as sent", marked, len(refs))
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("error marking %d notes as sent, processing one by one: %v", len(refs), err)
+		for i, ref := range refs {
+			if _, err = n.notes.MarkSent(ctx, []model.NoteRef{ref}); err == nil {
+				continue
+			}
+			spans[i].SetStatus(codes.Error, err.Error())
+			if err = n.deadLetter(ctx, msgs[i], fmt.Errorf("failed to mark note as sent: %w", err)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = n.broker.CommitMessages(ctx, batch...); err != nil {
+		// Сообщения будут прочитаны повторно, MarkSent идемпотентен
+		log.Printf("error committing kafka offsets: %v", err)
+	}
+
+	metrics.ConsumerBatchSizeHistogram.Observe(float64(len(batch)))
+	metrics.ConsumerFlushLatencyHistogram.Observe(time.Since(startTime).Seconds())
+
+	return nil
+}
+
+// deadLetter отправляет необработанное сообщение в dead-letter топик вместе с причиной.
+// Отправка повторяется до успеха или отмены ctx, иначе сообщение было бы потеряно при коммите offset.
+func (n *Notifier) deadLetter(ctx context.Context, msg kafka.Message, cause error) error {
+	log.Printf("message at offset %d of partition %d goes to dead-letter topic: %v", msg.Offset, msg.Partition, cause)
+
+	key, value, err := kafka.EncodeDeadLetter(msg, cause)
+	if err != nil {
+		return err
+	}
+
+	err = withRetry(ctx, 0, func() error {
+		return n.dlq.SendMessage(ctx, key, value)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send message to dead-letter topic: %w", err)
+	}
+
+	metrics.DeadLetterCounter.Inc()
+	return nil
+}
+
+// withRetry вызывает fn, пока она не выполнится успешно, с экспоненциальной задержкой между попытками.
+// attempts - число попыток, 0 - без ограничения, пока не отменен ctx.
+func withRetry(ctx context.Context, attempts int, fn func() error) error {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempts > 0 && attempt >= attempts {
+			return err
+		}
+
+		log.Printf("attempt %d failed, retry in %s: %v", attempt, delay, err)
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return errors.Join(err, sleepErr)
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
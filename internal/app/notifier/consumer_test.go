@@ -0,0 +1,91 @@
+package notifier
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/config"
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/service/kafka"
+	"github.com/kotche/bot/internal/service/notes"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeNotes запоминает отмеченные заметки и span, в котором их отметили
+type fakeNotes struct {
+	notes.Service
+
+	marked   []model.NoteRef
+	markSpan trace.SpanContext
+}
+
+func (f *fakeNotes) MarkSent(ctx context.Context, refs []model.NoteRef) (int64, error) {
+	f.marked = append(f.marked, refs...)
+	f.markSpan = trace.SpanContextFromContext(ctx)
+	return int64(len(refs)), nil
+}
+
+func TestFlushSentBatchTracesDeliveries(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	// Доставка напоминания в своей трассировке, контекст передается в заголовках сообщения
+	deliveryCtx, deliverySpan := provider.Tracer("test").Start(context.Background(), "deliver")
+	deliverySpan.End()
+
+	memoryLog := kafka.NewMemoryLog()
+	producer := memoryLog.Broker("notes", "")
+	consumer := memoryLog.Broker("notes", "group")
+
+	key, value, err := kafka.EncodeEvent(kafka.NewEvent(kafka.EventNoteDelivered, 42, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = producer.SendMessages(deliveryCtx, kafka.Message{Key: key, Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := consumer.FetchMessage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeNotes{}
+	n := &Notifier{notes: fake, broker: consumer, dlq: memoryLog.Broker("notes-dlq", ""), cfg: config.NotifierConfig{ConsumerMaxRetries: 1}}
+	if err = n.flushSentBatch(context.Background(), []kafka.Message{msg}); err != nil {
+		t.Fatalf("flushSentBatch: %v", err)
+	}
+
+	if len(fake.marked) != 1 || fake.marked[0] != (model.NoteRef{ID: 42, UserID: 7}) {
+		t.Fatalf("marked = %v", fake.marked)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	messageSpan, batchSpan := spans["MarkSent_consumer"], spans["MarkSentBatch_consumer"]
+	if messageSpan == nil || batchSpan == nil {
+		t.Fatalf("spans = %v, want message and batch spans", spans)
+	}
+
+	deliveryTrace := deliverySpan.SpanContext().TraceID()
+	if messageSpan.SpanContext().TraceID() != deliveryTrace {
+		t.Fatal("message span must continue the delivery trace")
+	}
+	if messageSpan.EndTime().Before(batchSpan.EndTime()) {
+		t.Fatal("message span must stay open until the batch is written")
+	}
+	if links := batchSpan.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != messageSpan.SpanContext().SpanID() {
+		t.Fatalf("batch links = %v, want the message span", links)
+	}
+	if fake.markSpan.SpanID() != batchSpan.SpanContext().SpanID() {
+		t.Fatal("MarkSent must run in the batch span")
+	}
+}
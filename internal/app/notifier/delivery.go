@@ -0,0 +1,143 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/internal/config"
+	"golang.org/x/time/rate"
+	"gopkg.in/telebot.v3"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// chatLimiterTTL через сколько неиспользуемый лимитер чата удаляется
+	chatLimiterTTL = 10 * time.Minute
+)
+
+// errFloodWaitTooLong telegram просит ждать дольше, чем действует захват напоминания
+var errFloodWaitTooLong = errors.New("telegram retry_after exceeds claim lease")
+
+// messageSender отправка сообщения в telegram, реализуется *telebot.Bot
+type messageSender interface {
+	Send(to telebot.Recipient, what interface{}, opts ...interface{}) (*telebot.Message, error)
+}
+
+// sender отправляет сообщения с учетом лимитов telegram: общий лимит бота и лимит на чат
+// (token bucket). На 429 ждет retry_after, временные ошибки повторяет с экспоненциальной задержкой.
+type sender struct {
+	bot     messageSender
+	global  *rate.Limiter
+	perChat rate.Limit
+	retries int
+	// maxFloodWait дольше этого на 429 не ждем: захват напоминания истечет раньше
+	maxFloodWait time.Duration
+	// sleep ожидание между попытками, в тестах подменяется
+	sleep func(ctx context.Context, delay time.Duration) error
+
+	mu        sync.Mutex
+	chats     map[int64]*chatLimiter
+	lastPrune time.Time
+}
+
+type chatLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+func newSender(bot messageSender, cfg config.NotifierConfig) *sender {
+	return &sender{
+		bot:          bot,
+		global:       rate.NewLimiter(rate.Limit(cfg.SendRate), max(1, int(cfg.SendRate))),
+		perChat:      rate.Limit(cfg.ChatSendRate),
+		retries:      cfg.SendRetries,
+		maxFloodWait: cfg.ClaimLease / 2,
+		sleep:        sleep,
+		chats:        make(map[int64]*chatLimiter),
+		lastPrune:    time.Now(),
+	}
+}
+
+// Send отправляет сообщение пользователю. Постоянные ошибки (пользователь заблокировал бота,
+// чат не найден, некорректный запрос) возвращаются сразу, без повторов. Если telegram просит ждать
+// дольше maxFloodWait, возвращается errFloodWaitTooLong.
+func (s *sender) Send(ctx context.Context, userID int64, message string, opts ...interface{}) error {
+	chat := s.chatLimiter(userID)
+	delay := retryDelay
+
+	for attempt := 1; ; attempt++ {
+		if err := s.global.Wait(ctx); err != nil {
+			return err
+		}
+		if err := chat.Wait(ctx); err != nil {
+			return err
+		}
+
+		_, err := s.bot.Send(&telebot.User{ID: userID}, message, opts...)
+		if err == nil {
+			return nil
+		}
+
+		var flood telebot.FloodError
+		switch {
+		case errors.As(err, &flood):
+			// Лимит превышен, несмотря на ограничители: telegram сам говорит, сколько ждать
+			metrics.TelegramRateLimitedCounter.Inc()
+			wait := time.Duration(flood.RetryAfter) * time.Second
+			log.Printf("telegram rate limit for user %d, retry after %s", userID, wait)
+			if wait > s.maxFloodWait {
+				return fmt.Errorf("%w: %w", errFloodWaitTooLong, err)
+			}
+			if attempt > s.retries {
+				return err
+			}
+			if err = s.sleep(ctx, wait); err != nil {
+				return err
+			}
+		case isPermanent(err):
+			return err
+		default:
+			if attempt > s.retries {
+				return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+			}
+			log.Printf("failed to send message to user %d, retry in %s: %v", userID, delay, err)
+			if err = s.sleep(ctx, delay); err != nil {
+				return err
+			}
+			delay = min(delay*2, maxRetryDelay)
+		}
+	}
+}
+
+// isPermanent ошибка telegram, которую бессмысленно повторять: 4xx кроме 429
+func isPermanent(err error) bool {
+	var apiErr *telebot.Error
+	return errors.As(err, &apiErr) && apiErr.Code >= 400 && apiErr.Code < 500
+}
+
+func (s *sender) chatLimiter(userID int64) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > chatLimiterTTL {
+		for id, chat := range s.chats {
+			if now.Sub(chat.lastUsed) > chatLimiterTTL {
+				delete(s.chats, id)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	chat, ok := s.chats[userID]
+	if !ok {
+		chat = &chatLimiter{limiter: rate.NewLimiter(s.perChat, 1)}
+		s.chats[userID] = chat
+	}
+	chat.lastUsed = now
+
+	return chat.limiter
+}
@@ -0,0 +1,176 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/internal/config"
+	"gopkg.in/telebot.v3"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeBot возвращает ошибки из errs по очереди, после них - успех
+type fakeBot struct {
+	errs  []error
+	calls int
+}
+
+func (b *fakeBot) Send(telebot.Recipient, interface{}, ...interface{}) (*telebot.Message, error) {
+	b.calls++
+	if b.calls <= len(b.errs) {
+		return nil, b.errs[b.calls-1]
+	}
+	return &telebot.Message{}, nil
+}
+
+// newTestSender отправляет через bot без ограничения частоты и записывает задержки вместо ожидания
+func newTestSender(bot messageSender, retries int) (*sender, *[]time.Duration) {
+	s := newSender(bot, config.NotifierConfig{
+		SendRate:     1e6,
+		ChatSendRate: 1e6,
+		SendRetries:  retries,
+		ClaimLease:   time.Minute,
+	})
+	delays := &[]time.Duration{}
+	s.sleep = func(ctx context.Context, delay time.Duration) error {
+		*delays = append(*delays, delay)
+		return ctx.Err()
+	}
+	return s, delays
+}
+
+// floodError ответ telegram 429 с retry_after, как его разбирает telebot
+func floodError(t *testing.T, retryAfter int) error {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(rw, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after %d","parameters":{"retry_after":%d}}`,
+			retryAfter, retryAfter)
+	}))
+	defer server.Close()
+
+	bot, err := telebot.NewBot(telebot.Settings{URL: server.URL, Token: "token", Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bot.Raw("sendMessage", nil)
+
+	var flood telebot.FloodError
+	if !errors.As(err, &flood) {
+		t.Fatalf("expected flood error, got %v", err)
+	}
+	return err
+}
+
+func TestSenderRetriesTemporaryErrors(t *testing.T) {
+	temporary := errors.New("connection reset")
+	bot := &fakeBot{errs: []error{temporary, temporary}}
+	s, delays := newTestSender(bot, 3)
+
+	if err := s.Send(context.Background(), 1, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bot.calls != 3 {
+		t.Fatalf("calls = %d, want 3", bot.calls)
+	}
+	if want := []time.Duration{retryDelay, 2 * retryDelay}; !slices.Equal(*delays, want) {
+		t.Fatalf("delays = %v, want %v", *delays, want)
+	}
+}
+
+func TestSenderGivesUpAfterRetries(t *testing.T) {
+	temporary := errors.New("connection reset")
+	bot := &fakeBot{errs: []error{temporary, temporary, temporary, temporary}}
+	s, delays := newTestSender(bot, 2)
+
+	err := s.Send(context.Background(), 1, "text")
+	if !errors.Is(err, temporary) {
+		t.Fatalf("expected %v, got %v", temporary, err)
+	}
+	if bot.calls != 3 {
+		t.Fatalf("calls = %d, want 3", bot.calls)
+	}
+	if len(*delays) != 2 {
+		t.Fatalf("delays = %v, want 2", *delays)
+	}
+}
+
+func TestSenderBackoffIsCapped(t *testing.T) {
+	errs := make([]error, 9)
+	for i := range errs {
+		errs[i] = errors.New("timeout")
+	}
+	s, delays := newTestSender(&fakeBot{errs: errs}, 9)
+
+	if err := s.Send(context.Background(), 1, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		32 * time.Second, maxRetryDelay, maxRetryDelay, maxRetryDelay,
+	}
+	if !slices.Equal(*delays, want) {
+		t.Fatalf("delays = %v, want %v", *delays, want)
+	}
+}
+
+func TestSenderDoesNotRetryPermanentErrors(t *testing.T) {
+	bot := &fakeBot{errs: []error{telebot.ErrBlockedByUser}}
+	s, delays := newTestSender(bot, 3)
+
+	err := s.Send(context.Background(), 1, "text")
+	if !errors.Is(err, telebot.ErrBlockedByUser) {
+		t.Fatalf("expected %v, got %v", telebot.ErrBlockedByUser, err)
+	}
+	if bot.calls != 1 || len(*delays) != 0 {
+		t.Fatalf("calls = %d, delays = %v, want one call without delays", bot.calls, *delays)
+	}
+}
+
+func TestSenderWaitsRetryAfter(t *testing.T) {
+	bot := &fakeBot{errs: []error{floodError(t, 5)}}
+	s, delays := newTestSender(bot, 3)
+
+	if err := s.Send(context.Background(), 1, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []time.Duration{5 * time.Second}; !slices.Equal(*delays, want) {
+		t.Fatalf("delays = %v, want %v", *delays, want)
+	}
+}
+
+func TestSenderFloodWaitTooLong(t *testing.T) {
+	// Захват на минуту: ждать больше 30 секунд нельзя
+	bot := &fakeBot{errs: []error{floodError(t, 31)}}
+	s, delays := newTestSender(bot, 3)
+
+	err := s.Send(context.Background(), 1, "text")
+	if !errors.Is(err, errFloodWaitTooLong) {
+		t.Fatalf("expected %v, got %v", errFloodWaitTooLong, err)
+	}
+	if bot.calls != 1 || len(*delays) != 0 {
+		t.Fatalf("calls = %d, delays = %v, want one call without delays", bot.calls, *delays)
+	}
+}
+
+func TestSenderStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	bot := &fakeBot{errs: []error{errors.New("timeout"), errors.New("timeout")}}
+	s, _ := newTestSender(bot, 3)
+	s.sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}
+
+	if err := s.Send(ctx, 1, "text"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if bot.calls != 1 {
+		t.Fatalf("calls = %d, want 1", bot.calls)
+	}
+}
@@ -2,134 +2,525 @@ package notifier
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/config"
 	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/recurrence"
 	"github.com/kotche/bot/internal/service/kafka"
 	"github.com/kotche/bot/internal/service/notes"
+	"github.com/kotche/bot/internal/service/outbox"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"gopkg.in/telebot.v3"
 	"log"
 	"strconv"
+	"sync"
 	"time"
 )
 
 const (
 	checkInterval = time.Minute
+
+	callbackTimeout = 2 * time.Second
+
+	// параметры relay сообщений из outbox в kafka
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	// outboxPurgeInterval как часто удалять опубликованные сообщения старше OutboxRetention
+	outboxPurgeInterval = time.Hour
+
+	// задержки повторов при недоступности kafka или БД
+	retryDelay    = time.Second
+	maxRetryDelay = time.Minute
 )
 
+// snoozeOptions кнопки "отложить": unique кнопки -> текст и вычисление нового времени в часовом поясе пользователя
+var snoozeOptions = []struct {
+	unique string
+	text   string
+	next   func(now time.Time) time.Time
+}{
+	{unique: "snooze_10m", text: "+10 мин", next: func(now time.Time) time.Time { return now.Add(10 * time.Minute) }},
+	{unique: "snooze_1h", text: "+1 час", next: func(now time.Time) time.Time { return now.Add(time.Hour) }},
+	{unique: "snooze_tomorrow", text: "Завтра", next: func(now time.Time) time.Time { return now.AddDate(0, 0, 1) }},
+}
+
 type Notifier struct {
 	bot    *telebot.Bot
 	notes  notes.Service
 	broker kafka.MessageBroker
+	// dlq dead-letter топик для сообщений, которые не удалось обработать
+	dlq    kafka.MessageBroker
+	outbox outbox.Service
+	sender *sender
+	cfg    config.NotifierConfig
+
+	inFlight sync.WaitGroup
 }
 
-func New(bot *telebot.Bot, notes notes.Service, broker kafka.MessageBroker) *Notifier {
+func New(bot *telebot.Bot, notes notes.Service, broker, dlq kafka.MessageBroker, outbox outbox.Service, cfg config.NotifierConfig) *Notifier {
 	return &Notifier{
 		bot:    bot,
 		notes:  notes,
 		broker: broker,
+		dlq:    dlq,
+		outbox: outbox,
+		sender: newSender(bot, cfg),
+		cfg:    cfg,
 	}
 }
 
-func (n *Notifier) Start() {
-	log.Println("notifier started...")
+// Commands команды бота notifier, значения метки command в метриках
+var Commands = []string{"/start"}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// Start запускает бота и notifier и блокируется до отмены ctx. После отмены новые напоминания не захватываются,
+// текущая партия и нажатия кнопок дорабатываются, consumer записывает и коммитит собранную партию.
+func (n *Notifier) Start(ctx context.Context) {
+	n.bot.Use(tracing.Middleware, metrics.Middleware(Commands...), n.trackInFlight)
+	n.Register()
 
-	if err := n.sendNotifications(ctx); err != nil {
-		log.Printf("error sending notifications: %v", err)
-	}
+	go func() {
+		<-ctx.Done()
+		n.bot.Stop()
+	}()
+	go n.bot.Start()
+
+	n.Run(ctx)
+
+	n.inFlight.Wait()
+	log.Println("notifier stopped")
+}
+
+// Register регистрирует обработчики кнопок напоминаний и /start. Используется отдельно от Start,
+// когда writer и notifier работают на одном боте.
+func (n *Notifier) Register() {
+	n.startHandler()
+	n.snoozeHandler()
+	n.doneHandler()
+}
+
+// Run отправляет напоминания, публикует outbox и отмечает доставленные заметки до отмены ctx.
+// Бота не запускает и не останавливает.
+func (n *Notifier) Run(ctx context.Context) {
+	log.Println("notifier started...")
 
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
-		if err := n.runDeleteSentNotes(ctx); err != nil {
-			log.Printf("error deleting sent notes: %v", err)
+		defer wg.Done()
+		n.runOutboxRelay(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		if err := n.runMarkSentNotes(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("error marking sent notes: %v", err)
 		}
 	}()
 
+	if err := n.sendNotifications(ctx); err != nil {
+		log.Printf("error sending notifications: %v", err)
+	}
+
 	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if err := n.sendNotifications(ctx); err != nil {
-			log.Printf("error sending notifications: %v", err)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("notifier stopping...")
+			wg.Wait()
+			return
+		case <-ticker.C:
+			if err := n.sendNotifications(ctx); err != nil {
+				log.Printf("error sending notifications: %v", err)
+			}
 		}
 	}
 }
 
-func (n *Notifier) sendNotifications(ctx context.Context) error {
+// trackInFlight учитывает выполняющиеся обработчики, чтобы дождаться их при остановке
+func (n *Notifier) trackInFlight(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		n.inFlight.Add(1)
+		defer n.inFlight.Done()
+		return next(c)
+	}
+}
+
+// sendNotifications захватывает наступившие напоминания партиями и отправляет их.
+// Напоминания, пропущенные пока notifier был остановлен, остаются в статусе pending и отправляются
+// при следующем запуске. Несколько экземпляров делят работу через захват строк с арендой.
+// Отмена stopCtx прекращает захват новых партий, захваченная партия отправляется до конца.
+func (n *Notifier) sendNotifications(stopCtx context.Context) error {
+	ctx, span := tracing.StartSpan(context.WithoutCancel(stopCtx), "sendNotifications_notifier")
+	defer span.End()
+
 	startTime := time.Now()
 
-	//start := time.Date(2025, 1, 8, 15, 30, 0, 0, time.Local)
-	start := startTime.Truncate(checkInterval)
-	end := start.Add(checkInterval)
+	for stopCtx.Err() == nil {
+		notifications, reclaimed, err := n.notes.ClaimNotifications(ctx,
+			n.cfg.InstanceID, startTime, n.cfg.ClaimLease, n.cfg.ClaimBatchSize)
+		if err != nil {
+			return err
+		}
 
-	//log.Printf("ReceiveNotifications start '%s' and end '%s'", start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+		metrics.NotesClaimedCounter.Add(float64(len(notifications)))
+		if reclaimed > 0 {
+			log.Printf("reclaimed %d notifications with expired lease", reclaimed)
+			metrics.NotesReclaimedCounter.Add(float64(reclaimed))
+		}
 
-	notifications, err := n.notes.ReceiveNotifications(ctx, start, end)
-	if err != nil {
-		return err
+		if err = n.processNotifications(ctx, startTime, notifications); err != nil {
+			return err
+		}
+
+		if len(notifications) < n.cfg.ClaimBatchSize {
+			break
+		}
 	}
 
+	duration := time.Since(startTime).Seconds()
+	// response time
+	metrics.ResponseTimeHistogram.Observe(duration)
+
+	n.updateClaimStats(ctx)
+
+	return nil
+}
+
+// processNotifications отправляет партию параллельно в SendWorkers потоков. Заметки одного пользователя
+// попадают в один поток и уходят по порядку. Ошибка одной заметки не мешает отправке остальных.
+func (n *Notifier) processNotifications(ctx context.Context, startTime time.Time, notifications []model.Note) error {
+	queues := make([]chan model.Note, n.cfg.SendWorkers)
+	for i := range queues {
+		queues[i] = make(chan model.Note, len(notifications))
+	}
 	for _, note := range notifications {
-		message := fmt.Sprintf("%s (id %d)", note.Text, note.ID)
+		queues[int(note.UserID%model.UserID(len(queues)))] <- note
+	}
 
-		if _, err = n.bot.Send(&telebot.User{ID: int64(note.UserID)}, message); err != nil {
-			return fmt.Errorf("failed to send notification to user %d: %v", note.UserID, err)
-		} else {
-			log.Printf("notification sent to user %d: %s", note.UserID, message)
+	var wg sync.WaitGroup
+	for _, queue := range queues {
+		close(queue)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for note := range queue {
+				if err := n.processNotification(ctx, startTime, note); err != nil {
+					log.Printf("failed to process note '%d' for user '%d': %v", note.ID, note.UserID, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// processNotification отправляет одно напоминание, span напоминания продолжается в kafka через outbox
+func (n *Notifier) processNotification(ctx context.Context, startTime time.Time, note model.Note) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "processNotification_notifier")
+	span.SetAttributes(attribute.Int64("note.id", int64(note.ID)), attribute.Int64("note.user_id", int64(note.UserID)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
+		span.End()
+	}()
+
+	lateness := startTime.Sub(note.NotifyAt)
+	if n.cfg.MaxLateness > 0 && lateness > n.cfg.MaxLateness {
+		log.Printf("note '%d' for user '%d' is %s late, skipped", note.ID, note.UserID, lateness.Round(time.Second))
+		if note.Recurrence != "" {
+			if err = n.skipOccurrence(ctx, note); err == nil {
+				return nil
+			}
+			log.Printf("failed to schedule next occurrence of note '%d': %v", note.ID, err)
+		}
+		return n.notes.MarkFailed(ctx, note.ID, note.UserID, n.cfg.InstanceID)
+	}
+
+	message := fmt.Sprintf("%s (id %d)", note.Text, note.ID)
+	if lateness > checkInterval {
+		message += n.lateSuffix(ctx, note)
+	}
+
+	if err = n.sender.Send(ctx, int64(note.UserID), message, notificationMarkup(note.ID)); err != nil {
+		if state, ok := undeliverableState(err); ok {
+			// Напоминание остается в pending: отправка продолжится, когда пользователь запустит бота
+			n.pauseDelivery(ctx, note.UserID, state, err)
+			return nil
+		}
+		if errors.Is(err, errFloodWaitTooLong) {
+			// Напоминание остается в pending, после истечения захвата его отправит следующий проход
+			log.Printf("note '%d' for user '%d' postponed: %v", note.ID, note.UserID, err)
+			return nil
+		}
+		if markErr := n.notes.MarkFailed(ctx, note.ID, note.UserID, n.cfg.InstanceID); markErr != nil {
+			log.Printf("failed to mark note '%d' as failed: %v", note.ID, markErr)
+		}
+		return fmt.Errorf("failed to send notification to user %d: %v", note.UserID, err)
+	} else {
+		log.Printf("notification sent to user %d: %s", note.UserID, message)
+	}
+	// Обновляет строку, только если доставка была приостановлена
+	if _, err := n.notes.UpdateDeliveryState(ctx, note.UserID, model.DeliveryStateActive, ""); err != nil {
+		log.Printf("failed to set delivery state of user '%d': %v", note.UserID, err)
+	}
 
-		metrics.NotesSentCounter.Inc()
+	metrics.NotesSentCounter.Inc()
+	metrics.DeliveryDelayHistogram.Observe(time.Since(note.NotifyAt).Seconds())
 
-		if err = n.broker.SendMessage(ctx,
-			[]byte(fmt.Sprintf("%d", note.UserID)),
-			[]byte(fmt.Sprintf("%d", note.ID)),
-		); err != nil {
-			log.Printf("failed to send message to kafka: %v", err)
+	var nextNotifyAt *time.Time
+	if note.Recurrence != "" {
+		next, err := n.nextOccurrence(ctx, note)
+		if err == nil {
+			nextNotifyAt = &next
 		} else {
-			log.Printf("note '%d' for user '%d' sent to kafka", note.ID, note.UserID)
+			// Повторение сломано: завершаем заметку как разовую, чтобы не слать ее каждую минуту
+			log.Printf("failed to schedule next occurrence of note '%d': %v", note.ID, err)
 		}
 	}
 
-	duration := time.Since(startTime).Seconds()
-	// response time
-	metrics.ResponseTimeHistogram.Observe(duration)
+	// Статус и событие для kafka пишутся в одной транзакции, событие опубликует relay.
+	// При ошибке захват истечет и напоминание будет отправлено повторно.
+	if err := n.notes.CompleteDelivery(ctx, note, n.cfg.InstanceID, nextNotifyAt); err != nil {
+		log.Printf("failed to complete delivery of note '%d' for user '%d': %v", note.ID, note.UserID, err)
+		span.RecordError(err)
+		return nil
+	}
+
+	if nextNotifyAt != nil {
+		log.Printf("note '%d' for user '%d' rescheduled to %s", note.ID, note.UserID, nextNotifyAt.Format("2006-01-02 15:04"))
+	}
 
 	return nil
 }
 
-func (n *Notifier) runDeleteSentNotes(ctx context.Context) error {
+// updateClaimStats обновляет метрики захватов напоминаний
+func (n *Notifier) updateClaimStats(ctx context.Context) {
+	stats, err := n.notes.ClaimStats(ctx)
+	if err != nil {
+		log.Printf("failed to get claim stats: %v", err)
+		return
+	}
+
+	metrics.PendingNotesGauge.Set(float64(stats.Pending))
+	metrics.ActiveClaimsGauge.Set(float64(stats.Active))
+	metrics.ExpiredClaimsGauge.Set(float64(stats.Expired))
+}
+
+// lateSuffix пометка для напоминания, доставленного с опозданием
+func (n *Notifier) lateSuffix(ctx context.Context, note model.Note) string {
+	loc, err := n.notes.UserLocation(ctx, note.UserID)
+	if err != nil {
+		log.Printf("failed to get time zone of user '%d': %v", note.UserID, err)
+		return "\n\nНапоминание доставлено с опозданием"
+	}
+	return fmt.Sprintf("\n\nНапоминание доставлено с опозданием, время напоминания: %s",
+		note.NotifyAt.In(loc).Format("2006-01-02 15:04"))
+}
+
+// notificationMarkup кнопки под напоминанием: отложить и выполнено
+func notificationMarkup(noteID model.NoteID) *telebot.ReplyMarkup {
+	data := strconv.FormatInt(int64(noteID), 10)
+
+	snoozeRow := make([]telebot.InlineButton, 0, len(snoozeOptions))
+	for _, option := range snoozeOptions {
+		snoozeRow = append(snoozeRow, telebot.InlineButton{Unique: option.unique, Text: option.text, Data: data})
+	}
+
+	markup := &telebot.ReplyMarkup{}
+	markup.InlineKeyboard = [][]telebot.InlineButton{
+		snoozeRow,
+		{telebot.InlineButton{Unique: "done", Text: "Выполнено", Data: data}},
+	}
+	return markup
+}
+
+// startHandler обработчик запуска бота пользователем, возобновляет приостановленную доставку напоминаний
+func (n *Notifier) startHandler() {
+	n.bot.Handle("/start", func(c telebot.Context) error {
+		userID := model.UserID(c.Sender().ID)
+
+		ctx, cancel := context.WithTimeout(tracing.Context(c), callbackTimeout)
+		defer cancel()
+
+		resumed, err := n.notes.SetDeliveryState(ctx, model.User{ID: userID, Login: c.Sender().Username}, model.DeliveryStateActive, "")
+		if err != nil {
+			log.Printf("failed to activate delivery for user '%d': %v", userID, err)
+			return c.Send("Не удалось включить напоминания. Попробуйте позже.")
+		}
+		if resumed {
+			log.Printf("delivery for user '%d' resumed", userID)
+		}
+
+		return c.Send("Напоминания включены.")
+	})
+}
+
+// pauseDelivery записывает, что пользователю нельзя отправить сообщение, его напоминания больше не захватываются
+func (n *Notifier) pauseDelivery(ctx context.Context, userID model.UserID, state model.DeliveryState, reason error) {
+	changed, err := n.notes.UpdateDeliveryState(ctx, userID, state, reason.Error())
+	if err != nil {
+		log.Printf("failed to pause delivery for user '%d': %v", userID, err)
+		return
+	}
+	if changed {
+		metrics.DeliveryPausedCounter.WithLabelValues(string(state)).Inc()
+		log.Printf("delivery for user '%d' paused (%s): %v", userID, state, reason)
+	}
+}
+
+// undeliverableState определяет по ошибке telegram, что пользователь заблокировал бота или не запускал его
+func undeliverableState(err error) (model.DeliveryState, bool) {
+	switch {
+	case errors.Is(err, telebot.ErrBlockedByUser), errors.Is(err, telebot.ErrUserIsDeactivated):
+		return model.DeliveryStateBlocked, true
+	case errors.Is(err, telebot.ErrChatNotFound), errors.Is(err, telebot.ErrNotStartedByUser):
+		return model.DeliveryStateChatNotFound, true
+	}
+	return "", false
+}
+
+// snoozeHandler обработчик отложить напоминание
+func (n *Notifier) snoozeHandler() {
+	for _, option := range snoozeOptions {
+		n.bot.Handle(&telebot.InlineButton{Unique: option.unique}, func(c telebot.Context) error {
+			noteID, err := strconv.ParseInt(c.Data(), 10, 64)
+			if err != nil {
+				log.Printf("failed to parse note id '%s': %v", c.Data(), err)
+				return c.Respond(&telebot.CallbackResponse{Text: "Некорректная кнопка"})
+			}
+			userID := model.UserID(c.Sender().ID)
+
+			ctx, cancel := context.WithTimeout(tracing.Context(c), callbackTimeout)
+			defer cancel()
+
+			loc, err := n.notes.UserLocation(ctx, userID)
+			if err != nil {
+				log.Printf("failed to get time zone of user '%d': %v", userID, err)
+				return c.Respond(&telebot.CallbackResponse{Text: "Не удалось отложить напоминание. Попробуйте позже."})
+			}
+
+			notifyAt := option.next(time.Now().In(loc))
+			if err = n.notes.Snooze(ctx, model.NoteID(noteID), userID, notifyAt); err != nil {
+				log.Printf("failed to snooze note '%d' for user '%d': %v", noteID, userID, err)
+				return c.Respond(&telebot.CallbackResponse{Text: "Не удалось отложить напоминание. Попробуйте позже."})
+			}
+
+			log.Printf("note '%d' for user '%d' snoozed to %s", noteID, userID, notifyAt.Format("2006-01-02 15:04"))
+			return n.closeNotification(c, fmt.Sprintf("Отложено до %s", notifyAt.Format("2006-01-02 15:04")))
+		})
+	}
+}
+
+// doneHandler обработчик отметить напоминание выполненным
+func (n *Notifier) doneHandler() {
+	n.bot.Handle(&telebot.InlineButton{Unique: "done"}, func(c telebot.Context) error {
+		noteID, err := strconv.ParseInt(c.Data(), 10, 64)
+		if err != nil {
+			log.Printf("failed to parse note id '%s': %v", c.Data(), err)
+			return c.Respond(&telebot.CallbackResponse{Text: "Некорректная кнопка"})
+		}
+		userID := model.UserID(c.Sender().ID)
+
+		ctx, cancel := context.WithTimeout(tracing.Context(c), callbackTimeout)
+		defer cancel()
+
+		if err = n.notes.Acknowledge(ctx, model.NoteID(noteID), userID); err != nil {
+			log.Printf("failed to acknowledge note '%d' for user '%d': %v", noteID, userID, err)
+			return c.Respond(&telebot.CallbackResponse{Text: "Не удалось отметить напоминание. Попробуйте позже."})
+		}
+
+		log.Printf("note '%d' for user '%d' acknowledged", noteID, userID)
+		return n.closeNotification(c, "Выполнено")
+	})
+}
+
+// closeNotification убирает кнопки из напоминания и дописывает итог действия
+func (n *Notifier) closeNotification(c telebot.Context, result string) error {
+	if err := c.Respond(&telebot.CallbackResponse{Text: result}); err != nil {
+		log.Printf("failed to respond to callback: %v", err)
+	}
+	return c.Edit(fmt.Sprintf("%s\n\n%s", c.Message().Text, result))
+}
+
+// nextOccurrence вычисляет следующее срабатывание повторяющегося напоминания
+func (n *Notifier) nextOccurrence(ctx context.Context, note model.Note) (time.Time, error) {
+	rule, err := recurrence.Parse(note.Recurrence)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse recurrence '%s': %w", note.Recurrence, err)
+	}
+
+	// Правило считается в часовом поясе пользователя: "daily 09:00" - 9 утра по его времени
+	loc, err := n.notes.UserLocation(ctx, note.UserID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := rule.NextAfterNow(note.NotifyAt.In(loc), time.Now().In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("recurrence '%s' has no next occurrence", note.Recurrence)
+	}
+
+	return next, nil
+}
+
+// skipOccurrence переносит опоздавшее повторяющееся напоминание на следующее срабатывание без отправки
+func (n *Notifier) skipOccurrence(ctx context.Context, note model.Note) error {
+	next, err := n.nextOccurrence(ctx, note)
+	if err != nil {
+		return err
+	}
+
+	if err = n.notes.SkipOccurrence(ctx, note.ID, note.UserID, n.cfg.InstanceID, next); err != nil {
+		return err
+	}
+
+	log.Printf("note '%d' for user '%d' skipped to %s", note.ID, note.UserID, next.Format("2006-01-02 15:04"))
+	return nil
+}
+
+// runOutboxRelay публикует сообщения из outbox в kafka и раз в outboxPurgeInterval удаляет опубликованные.
+// Пока kafka недоступна, интервал между попытками растет экспоненциально до maxRetryDelay.
+func (n *Notifier) runOutboxRelay(ctx context.Context) {
+	delay := outboxPollInterval
+	lastPurge := time.Now()
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
+			return
+		case <-time.After(delay):
 		}
 
-		key, val, err := n.broker.ReadMessage(ctx)
-		if err != nil {
-			log.Printf("error reading message from kafka: %v", err)
-			continue
+		if n.cfg.OutboxRetention > 0 && time.Since(lastPurge) >= outboxPurgeInterval {
+			lastPurge = time.Now()
+			if purged, err := n.outbox.PurgePublished(ctx, n.cfg.OutboxRetention); err != nil {
+				log.Printf("failed to purge published outbox messages: %v", err)
+			} else if purged > 0 {
+				log.Printf("purged %d published outbox messages", purged)
+			}
 		}
 
-		userID, err := strconv.ParseInt(string(key), 10, 64)
+		published, err := n.outbox.PublishPending(ctx, n.cfg.InstanceID, n.cfg.ClaimLease, outboxBatchSize)
 		if err != nil {
-			log.Printf("error converting user id `%s` to int: %v", key, err)
+			delay = min(delay*2, maxRetryDelay)
+			log.Printf("failed to publish outbox messages, retry in %s: %v", delay, err)
 			continue
 		}
+		delay = outboxPollInterval
 
-		noteID, err := strconv.ParseInt(string(val), 10, 64)
-		if err != nil {
-			log.Printf("error converting note id `%s` to int: %v", key, err)
-			continue
+		if published > 0 {
+			log.Printf("published %d outbox messages to kafka", published)
 		}
-
-		//TODO(cheki) удалять батчами
-		if err = n.notes.Delete(ctx, model.NoteID(noteID), model.UserID(userID)); err != nil {
-			log.Printf("error deleting note %d: %v", noteID, err)
+		// Партия заполнена целиком - в outbox, вероятно, есть еще сообщения
+		if published == outboxBatchSize {
+			delay = 0
 		}
-
-		log.Printf("note '%d' for user '%d' deleted", noteID, userID)
 	}
 }
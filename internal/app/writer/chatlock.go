@@ -0,0 +1,60 @@
+package writer
+
+import (
+	"gopkg.in/telebot.v3"
+	"sync"
+)
+
+// chatLocks сериализует обработку обновлений одного чата: диалог читается, меняется и сохраняется
+// без гонки с соседним сообщением того же пользователя. Мьютекс чата удаляется, когда его никто не ждет.
+type chatLocks struct {
+	mu    sync.Mutex
+	chats map[int64]*chatLock
+}
+
+type chatLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+func newChatLocks() *chatLocks {
+	return &chatLocks{chats: make(map[int64]*chatLock)}
+}
+
+func (l *chatLocks) lock(chatID int64) func() {
+	l.mu.Lock()
+	chat, ok := l.chats[chatID]
+	if !ok {
+		chat = &chatLock{}
+		l.chats[chatID] = chat
+	}
+	chat.waiters++
+	l.mu.Unlock()
+
+	chat.mu.Lock()
+
+	return func() {
+		chat.mu.Unlock()
+
+		l.mu.Lock()
+		chat.waiters--
+		if chat.waiters == 0 {
+			delete(l.chats, chatID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Middleware обрабатывает обновления одного чата по очереди
+func (l *chatLocks) Middleware(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		chat := c.Chat()
+		if chat == nil {
+			return next(c)
+		}
+
+		unlock := l.lock(chat.ID)
+		defer unlock()
+		return next(c)
+	}
+}
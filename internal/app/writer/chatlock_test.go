@@ -0,0 +1,59 @@
+package writer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChatLocksSerializeSameChat(t *testing.T) {
+	locks := newChatLocks()
+
+	var (
+		wg      sync.WaitGroup
+		active  atomic.Int32
+		overlap atomic.Bool
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock(42)
+			defer unlock()
+
+			if active.Add(1) > 1 {
+				overlap.Store(true)
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if overlap.Load() {
+		t.Fatal("handlers of the same chat ran concurrently")
+	}
+	if len(locks.chats) != 0 {
+		t.Fatalf("chat locks leaked: %d", len(locks.chats))
+	}
+}
+
+func TestChatLocksDifferentChatsDoNotBlock(t *testing.T) {
+	locks := newChatLocks()
+
+	unlock := locks.lock(1)
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		locks.lock(2)()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock of another chat was blocked")
+	}
+}
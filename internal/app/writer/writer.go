@@ -4,52 +4,155 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/kotche/bot/infrastructure/metrics"
 	"github.com/kotche/bot/infrastructure/tracing"
 	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/recurrence"
+	"github.com/kotche/bot/internal/service/dialog"
 	"github.com/kotche/bot/internal/service/notes"
+	"github.com/kotche/bot/internal/service/tokens"
+	"github.com/kotche/bot/internal/timeparse"
 	"gopkg.in/telebot.v3"
 	"log"
+	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	longProcessTimeout = 2
+	// dialogEvictionInterval как часто удаляются брошенные диалоги
+	dialogEvictionInterval = time.Minute
+
+	editTimeMessage = "Введите новое время напоминания (например, «завтра в 9», «через 2 часа», «25.12 14:00»):"
+
+	remindWhenMessage = "Когда напомнить? Введите дату и время (например, «завтра в 9», «через 2 часа», " +
+		"«25.12 14:00») или номер месяца (1-12):"
 )
 
+// Commands команды бота, значения метки command в метриках
+var Commands = []string{"/help", "/new", "/cancel", "/remind", "/edit", "/repeat", "/timezone", "/delete", "/get", "/list", "/token"}
+
 type Writer struct {
-	bot   *telebot.Bot
-	notes notes.Service
+	bot     *telebot.Bot
+	notes   notes.Service
+	dialogs dialog.Service
+	tokens  tokens.Service
+	// notifierLink ссылка на запуск бота notifier, через который приходят напоминания.
+	// Пустая, если writer и notifier работают на одном боте.
+	notifierLink string
+
+	// handlers группа обработчиков, обновления одного чата обрабатываются по очереди
+	handlers *telebot.Group
+	chats    *chatLocks
+
+	inFlight sync.WaitGroup
 }
 
-func New(bot *telebot.Bot, notes notes.Service) *Writer {
-	return &Writer{bot: bot, notes: notes}
+// New создает writer. notifierUsername - имя бота notifier, пустое в режиме одного бота.
+func New(bot *telebot.Bot, notes notes.Service, dialogs dialog.Service, tokens tokens.Service, notifierUsername string) *Writer {
+	w := &Writer{bot: bot, notes: notes, dialogs: dialogs, tokens: tokens, chats: newChatLocks()}
+	if notifierUsername != "" {
+		w.notifierLink = fmt.Sprintf("https://t.me/%s?start=activate", notifierUsername)
+	}
+	return w
+}
+
+// Start запускает бота и блокируется до отмены ctx, после отмены дожидается выполняющихся обработчиков
+func (w *Writer) Start(ctx context.Context) {
+	w.bot.Use(tracing.Middleware, metrics.Middleware(Commands...), w.trackInFlight)
+	w.Register()
+	go w.RunDialogEviction(ctx)
+
+	go func() {
+		<-ctx.Done()
+		log.Println("writer stopping...")
+		w.bot.Stop()
+	}()
+
+	log.Println("writer started...")
+	w.bot.Start()
+
+	w.inFlight.Wait()
+	log.Println("writer stopped")
 }
 
-func (w *Writer) Start() {
+// Register регистрирует обработчики команд, используется отдельно от Start, когда writer и notifier работают на одном боте
+func (w *Writer) Register() {
+	w.handlers = w.bot.Group()
+	w.handlers.Use(w.chats.Middleware)
+
 	w.helpHandler()
 	w.createNoteHandler()
+	w.cancelHandler()
+	w.remindHandler()
+	w.editHandler()
+	w.repeatHandler()
+	w.timezoneHandler()
 	w.deleteHandler()
 	w.getHandler()
 	w.listNoteHandler()
+	w.tokenHandler()
+}
 
-	log.Println("writer started...")
-	w.bot.Start()
+// RunDialogEviction периодически удаляет брошенные диалоги до отмены ctx
+func (w *Writer) RunDialogEviction(ctx context.Context) {
+	ticker := time.NewTicker(dialogEvictionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			evicted, err := w.dialogs.EvictExpired(ctx)
+			if err != nil {
+				log.Printf("failed to evict expired dialogs: %v", err)
+				continue
+			}
+			if evicted > 0 {
+				log.Printf("evicted %d expired dialogs", evicted)
+			}
+		}
+	}
+}
+
+// trackInFlight учитывает выполняющиеся обработчики, чтобы дождаться их при остановке
+func (w *Writer) trackInFlight(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		w.inFlight.Add(1)
+		defer w.inFlight.Done()
+		return next(c)
+	}
 }
 
 // helpHandler обработчик помощь
 func (w *Writer) helpHandler() {
 	helpMessage := "Доступные команды:\n" +
 		"/new - создать новую заметку\n" +
+		"/cancel - отменить создание или изменение заметки\n" +
+		"/remind {когда} {текст} - быстро создать напоминание\n" +
+		"	| например: /remind завтра 10:00 позвонить маме\n" +
+		"	| или: /remind через 2 часа выключить духовку\n" +
+		"/edit {id} - изменить текст или время заметки\n" +
+		"/repeat {id} {правило} - повторять напоминание:\n" +
+		"	| every 2h, daily 09:00, weekly mon,thu 09:00,\n" +
+		"	| monthly 15 09:00, cron 0 9 * * 1-5\n" +
+		"	| off - отключить повторение\n" +
+		"/timezone {зона} - часовой пояс, например Asia/Yekaterinburg\n" +
+		"	| без аргумента - показать текущий и выбрать по геопозиции\n" +
 		"/delete {id} - удалить заметку по id\n" +
 		"/get {id} - получить заметку по id\n" +
 		"/list - список заметок:\n" +
 		"	| по-умолчанию выводит активные заметки\n" +
-		"	| -a выводит все заметки (включая удаленные)\n" +
+		"	| -a выводит все заметки (включая отправленные и удаленные)\n" +
+		"/token - выпустить токен для REST API\n" +
+		"	| revoke - отозвать все токены\n" +
 		"/help - показать это сообщение"
 
-	w.bot.Handle("/help", func(c telebot.Context) error {
+	w.handlers.Handle("/help", func(c telebot.Context) error {
 		return c.Send(helpMessage)
 	})
 
@@ -58,30 +161,38 @@ func (w *Writer) helpHandler() {
 
 // createNoteHandler обработчик создать заметку
 func (w *Writer) createNoteHandler() {
-	var (
-		currentNote      string
-		selectedDateTime string
-		selectedMonth    time.Month
-		selectedDay      int
-		isCreatingNote   bool
-	)
-
-	w.bot.Handle("/new", func(c telebot.Context) error {
-		currentNote = ""
-		selectedDateTime = ""
-		selectedMonth = 0
-		selectedDay = 0
-		isCreatingNote = true
+	w.handlers.Handle("/new", func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		chatID := model.ChatID(c.Chat().ID)
+		if _, err := w.dialogs.Start(ctx, chatID); err != nil {
+			log.Printf("failed to start dialog for chat '%d': %v", chatID, err)
+			return c.Send("Не удалось начать создание заметки. Попробуйте позже.")
+		}
+
+		if err := w.warnUndeliverable(ctx, c); err != nil {
+			return err
+		}
+
 		return c.Send("Напечатайте текст заметки:", &telebot.ReplyMarkup{ForceReply: true})
 	})
 
-	w.bot.Handle(telebot.OnText, func(c telebot.Context) error {
-		if !isCreatingNote {
-			return nil // Игнорируем любой текст, если не в процессе создания заметки
+	w.handlers.Handle(telebot.OnText, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		dialog, err := w.getDialog(ctx, c)
+		if err != nil || dialog == nil {
+			return err // Игнорируем любой текст, если не в процессе создания заметки
 		}
 
-		if currentNote == "" {
-			currentNote = c.Text()
+		switch dialog.State {
+		case model.DialogStateAwaitingText:
+			dialog.Text = c.Text()
+			if err = w.advanceDialog(ctx, c, dialog, model.DialogStateConfirmText); err != nil {
+				return err
+			}
 			markup := &telebot.ReplyMarkup{}
 			markup.InlineKeyboard = [][]telebot.InlineButton{
 				{
@@ -89,72 +200,100 @@ func (w *Writer) createNoteHandler() {
 					telebot.InlineButton{Unique: "note_no", Text: "Нет"},
 				},
 			}
-			return c.Send(fmt.Sprintf("Ваша заметка: \"%s\". Продолжить?", currentNote), markup)
-		}
-		if selectedMonth == 0 {
+			return c.Send(fmt.Sprintf("Ваша заметка: \"%s\". Продолжить?", dialog.Text), markup)
+		case model.DialogStateAwaitingMonth:
 			month, err := strconv.Atoi(c.Text())
-			if err != nil || month < 1 || month > 12 {
+			if err != nil {
+				// Дата и время в свободной форме: "завтра в 9", "через 2 часа", "25.12 14:00"
+				loc := w.userLocation(ctx, model.UserID(c.Sender().ID))
+				notifyAt, rest, err := timeparse.Parse(c.Text(), time.Now().In(loc))
+				if err != nil || rest != "" {
+					return c.Send(remindWhenMessage)
+				}
+				if !notifyAt.After(time.Now()) {
+					return c.Send("Время напоминания уже прошло. Введите другое время:")
+				}
+				dialog.NotifyAt = notifyAt
+				if err = w.advanceDialog(ctx, c, dialog, model.DialogStateConfirmSave); err != nil {
+					return err
+				}
+				return w.sendSaveConfirmation(c, dialog, loc)
+			}
+			if month < 1 || month > 12 {
 				return c.Send("Введите номер месяца (1-12):")
 			}
-			selectedMonth = time.Month(month)
-			return w.sendDays(c, selectedMonth)
-		}
-		if selectedDay == 0 {
-			day, err := strconv.Atoi(c.Text())
-			if err != nil || day < 1 || day > 31 {
-				return c.Send("Введите корректный день месяца:")
+			dialog.Month = time.Month(month)
+			if err = w.advanceDialog(ctx, c, dialog, model.DialogStateAwaitingDay); err != nil {
+				return err
 			}
-			selectedDay = day
-			return c.Send("Введите время в формате HH или HH:MM (например, 14 или 15:37):")
-		}
-		if selectedDateTime == "" {
+			return w.sendDays(c, dialog.Month)
+		case model.DialogStateAwaitingDay:
+			return w.selectDay(ctx, c, dialog, c.Text())
+		case model.DialogStateEditText:
+			return w.editText(ctx, c, dialog)
+		case model.DialogStateEditTime:
+			return w.editTime(ctx, c, dialog)
+		case model.DialogStateAwaitingTime:
 			inputTime := c.Text()
 			if !isValidTimeFormat(inputTime) {
 				return c.Send("Введите корректное время в формате HH или HH:MM:")
 			}
-			year := time.Now().Year()
-			selectedDateTime = fmt.Sprintf("%d-%02d-%02d %s", year, selectedMonth, selectedDay, formatTime(inputTime))
-			markup := &telebot.ReplyMarkup{}
-			markup.InlineKeyboard = [][]telebot.InlineButton{
-				{
-					telebot.InlineButton{Unique: "save_yes", Text: "Да"},
-					telebot.InlineButton{Unique: "save_no", Text: "Нет"},
-				},
+			loc := w.userLocation(ctx, model.UserID(c.Sender().ID))
+			clock, _ := time.Parse("15:04", formatTime(inputTime))
+			dialog.NotifyAt = nextMonthDay(time.Now().In(loc), dialog.Month, dialog.Day, clock.Hour(), clock.Minute())
+			if err = w.advanceDialog(ctx, c, dialog, model.DialogStateConfirmSave); err != nil {
+				return err
 			}
-			return c.Send(fmt.Sprintf("Сохранить заметку: \"%s\" с напоминанием на %s?", currentNote, selectedDateTime), markup)
+			return w.sendSaveConfirmation(c, dialog, loc)
 		}
 		return nil
 	})
 
-	w.bot.Handle(&telebot.InlineButton{Unique: "note_yes"}, func(c telebot.Context) error {
-		return c.Send("Когда напомнить? Введите номер месяца (1-12):")
-	})
+	w.handlers.Handle(&telebot.InlineButton{Unique: "note_yes"}, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
 
-	w.bot.Handle(&telebot.InlineButton{Unique: "select_day"}, func(c telebot.Context) error {
-		day, err := strconv.Atoi(c.Data())
-		if err != nil || day < 1 || day > 31 {
-			return c.Send("Ошибка при выборе дня. Попробуйте ещё раз.")
+		dialog, err := w.getDialog(ctx, c)
+		if err != nil || dialog == nil {
+			return err
+		}
+		if err = w.advanceDialog(ctx, c, dialog, model.DialogStateAwaitingMonth); err != nil {
+			return err
 		}
+		return c.Send(remindWhenMessage)
+	})
+
+	w.handlers.Handle(&telebot.InlineButton{Unique: "select_day"}, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
 
-		selectedDay = day
-		return c.Send("Введите время в формате HH или HH:MM (например, 14 или 15:37):")
+		dialog, err := w.getDialog(ctx, c)
+		if err != nil || dialog == nil {
+			return err
+		}
+		return w.selectDay(ctx, c, dialog, c.Data())
 	})
 
-	w.bot.Handle(&telebot.InlineButton{Unique: "note_no"}, func(c telebot.Context) error {
-		currentNote = ""
-		return c.Send("Напечатайте новую заметку:", &telebot.ReplyMarkup{ForceReply: true})
+	w.handlers.Handle(&telebot.InlineButton{Unique: "note_no"}, func(c telebot.Context) error {
+		return w.restartDialog(c)
 	})
 
 	//Проверка юзера и сохранение заметки
-	w.bot.Handle(&telebot.InlineButton{Unique: "save_yes"}, func(c telebot.Context) error {
-		isCreatingNote = false
-
-		ctx, cancel := context.WithTimeout(context.Background(), longProcessTimeout*time.Second)
+	w.handlers.Handle(&telebot.InlineButton{Unique: "save_yes"}, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
 		defer cancel()
 
+		dialog, err := w.getDialog(ctx, c)
+		if err != nil || dialog == nil {
+			return err
+		}
+		if dialog.State != model.DialogStateConfirmSave {
+			return c.Send("Эта кнопка больше не активна.")
+		}
+
 		userID := model.UserID(c.Sender().ID)
 
-		if err := w.notes.EnsureUserExists(ctx, model.User{
+		if err = w.notes.EnsureUserExists(ctx, model.User{
 			ID:    userID,
 			Login: c.Sender().Username},
 		); err != nil {
@@ -166,41 +305,430 @@ func (w *Writer) createNoteHandler() {
 			return c.Send(fmt.Sprintf("Не удалось сохранить текущего пользователя '%d'", userID))
 		}
 
-		parsedTime, err := time.Parse("2006-01-02 15:04", selectedDateTime)
+		noteID, err := w.notes.Create(ctx, model.Note{
+			UserID:   userID,
+			Text:     dialog.Text,
+			NotifyAt: dialog.NotifyAt,
+		})
 		if err != nil {
-			log.Printf("failed to parse time '%s': %v", selectedDateTime, err)
-			return c.Send("Ошибка при обработке даты и времени. Попробуйте ещё раз.")
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("context deadline exceeded while creating note '%s' for user '%d': %v", dialog.Text, userID, err)
+				return c.Send("Операция сохранения заметки заняла слишком много времени. Попробуйте позже.")
+			}
+			log.Printf("failed to create note '%s' for user '%d': %v", dialog.Text, userID, err)
+			return c.Send(fmt.Sprintf("Не удалось сохранить заметку"))
+		}
+
+		if err = w.dialogs.Cancel(ctx, dialog.ChatID); err != nil {
+			log.Printf("failed to finish dialog for chat '%d': %v", dialog.ChatID, err)
+		}
+
+		loc := w.userLocation(ctx, userID)
+		return c.Send(fmt.Sprintf("Сохранена заметка \"%s\", id: %d. Напоминание %s.",
+			dialog.Text, noteID, dialog.NotifyAt.In(loc).Format("2006-01-02 15:04")))
+	})
+
+	w.handlers.Handle(&telebot.InlineButton{Unique: "save_no"}, func(c telebot.Context) error {
+		return w.restartDialog(c)
+	})
+}
+
+// cancelHandler обработчик отменить текущий диалог
+func (w *Writer) cancelHandler() {
+	w.handlers.Handle("/cancel", func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		chatID := model.ChatID(c.Chat().ID)
+		if err := w.dialogs.Cancel(ctx, chatID); err != nil {
+			log.Printf("failed to cancel dialog for chat '%d': %v", chatID, err)
+			return c.Send("Не удалось отменить операцию. Попробуйте позже.")
+		}
+
+		return c.Send("Операция отменена")
+	})
+}
+
+// remindHandler обработчик создать напоминание одной командой
+func (w *Writer) remindHandler() {
+	w.handlers.Handle("/remind", func(c telebot.Context) error {
+		payload := c.Message().Payload
+		if payload == "" {
+			return c.Send("Укажите время и текст напоминания, например: /remind завтра 10:00 позвонить маме")
+		}
+
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		userID := model.UserID(c.Sender().ID)
+		loc := w.userLocation(ctx, userID)
+
+		notifyAt, text, err := timeparse.Parse(payload, time.Now().In(loc))
+		if err != nil {
+			return c.Send("Не удалось распознать время напоминания. Примеры: «завтра в 9», «через 30 минут», «25.12 14:00»")
+		}
+		if text == "" {
+			return c.Send("Не указан текст напоминания!")
+		}
+		if !notifyAt.After(time.Now()) {
+			return c.Send("Время напоминания уже прошло")
+		}
+
+		if err = w.notes.EnsureUserExists(ctx, model.User{
+			ID:    userID,
+			Login: c.Sender().Username},
+		); err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("context deadline exceeded while ensuring user '%d': %v", userID, err)
+				return c.Send("Операция сохранения пользователя заняла слишком много времени. Попробуйте позже.")
+			}
+			log.Printf("failed to ensure user '%d' exists: %v", userID, err)
+			return c.Send(fmt.Sprintf("Не удалось сохранить текущего пользователя '%d'", userID))
 		}
 
 		noteID, err := w.notes.Create(ctx, model.Note{
 			UserID:   userID,
-			Text:     currentNote,
-			NotifyAt: parsedTime,
+			Text:     text,
+			NotifyAt: notifyAt,
 		})
 		if err != nil {
 			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-				log.Printf("context deadline exceeded while creating note '%s' for user '%d': %v", currentNote, userID, err)
+				log.Printf("context deadline exceeded while creating note '%s' for user '%d': %v", text, userID, err)
 				return c.Send("Операция сохранения заметки заняла слишком много времени. Попробуйте позже.")
 			}
-			log.Printf("failed to create note '%s' for user '%d': %v", currentNote, userID, err)
-			return c.Send(fmt.Sprintf("Не удалось сохранить заметку"))
+			log.Printf("failed to create note '%s' for user '%d': %v", text, userID, err)
+			return c.Send("Не удалось сохранить заметку")
+		}
+
+		return c.Send(fmt.Sprintf("Сохранена заметка \"%s\", id: %d. Напоминание %s.",
+			text, noteID, notifyAt.In(loc).Format("2006-01-02 15:04")))
+	})
+}
+
+// editHandler обработчик изменить заметку
+func (w *Writer) editHandler() {
+	w.handlers.Handle("/edit", func(c telebot.Context) error {
+		args := c.Args()
+		if len(args) == 0 {
+			return c.Send("Не указан id заметки!")
+		}
+
+		noteID, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Printf("failed to parse note id '%s': %v", args[0], err)
+			return c.Send("Не удалось преобразовать id заметки в числовое значение!")
+		}
+		userID := model.UserID(c.Sender().ID)
+
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		note, err := w.notes.Get(ctx, model.NoteID(noteID), userID)
+		if err != nil {
+			if errors.Is(err, model.ErrNoteNotFound) {
+				return c.Send(fmt.Sprintf("Заметка '%d' не найдена", noteID))
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("context deadline exceeded while get note %d for user '%d': %v", noteID, userID, err)
+				return c.Send("Операция получения заметки заняла слишком много времени. Попробуйте позже.")
+			}
+			log.Printf("failed to get note '%d' for user '%d': %v", noteID, userID, err)
+			return c.Send("Ошибка при получении заметки. Попробуйте позже.")
+		}
+		if note.DeletedAt != nil {
+			return c.Send(fmt.Sprintf("Заметка '%d' удалена, ее нельзя изменить", noteID))
+		}
+
+		chatID := model.ChatID(c.Chat().ID)
+		if _, err = w.dialogs.StartEdit(ctx, chatID, *note); err != nil {
+			log.Printf("failed to start edit dialog for chat '%d': %v", chatID, err)
+			return c.Send("Не удалось начать изменение заметки. Попробуйте позже.")
+		}
+
+		loc := w.userLocation(ctx, userID)
+		markup := &telebot.ReplyMarkup{}
+		markup.InlineKeyboard = [][]telebot.InlineButton{
+			{
+				telebot.InlineButton{Unique: "edit_text", Text: "Текст"},
+				telebot.InlineButton{Unique: "edit_time", Text: "Время"},
+				telebot.InlineButton{Unique: "edit_both", Text: "Текст и время"},
+			},
+		}
+		return c.Send(fmt.Sprintf("Заметка: \"%s\", напоминание %s. Что изменить?",
+			note.Text, note.NotifyAt.In(loc).Format("2006-01-02 15:04")), markup)
+	})
+
+	editTargets := map[string]model.EditTarget{
+		"edit_text": model.EditTargetText,
+		"edit_time": model.EditTargetTime,
+		"edit_both": model.EditTargetBoth,
+	}
+	for unique, target := range editTargets {
+		w.handlers.Handle(&telebot.InlineButton{Unique: unique}, func(c telebot.Context) error {
+			ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+			defer cancel()
+
+			dialog, err := w.getDialog(ctx, c)
+			if err != nil || dialog == nil {
+				return err
+			}
+
+			dialog.EditTarget = target
+			if target == model.EditTargetTime {
+				if err = w.advanceDialog(ctx, c, dialog, model.DialogStateEditTime); err != nil {
+					return err
+				}
+				return c.Send(editTimeMessage)
+			}
+
+			if err = w.advanceDialog(ctx, c, dialog, model.DialogStateEditText); err != nil {
+				return err
+			}
+			return c.Send("Напечатайте новый текст заметки:", &telebot.ReplyMarkup{ForceReply: true})
+		})
+	}
+
+	w.handlers.Handle(&telebot.InlineButton{Unique: "edit_save"}, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		dialog, err := w.getDialog(ctx, c)
+		if err != nil || dialog == nil {
+			return err
+		}
+		if dialog.State != model.DialogStateConfirmEdit {
+			return c.Send("Эта кнопка больше не активна.")
+		}
+
+		userID := model.UserID(c.Sender().ID)
+
+		if err = w.notes.Update(ctx, model.Note{
+			ID:       dialog.NoteID,
+			UserID:   userID,
+			Text:     dialog.Text,
+			NotifyAt: dialog.NotifyAt,
+		}); err != nil {
+			if errors.Is(err, model.ErrNoteNotFound) {
+				return c.Send(fmt.Sprintf("Заметка '%d' не найдена или уже удалена", dialog.NoteID))
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("context deadline exceeded while update note %d for user '%d': %v", dialog.NoteID, userID, err)
+				return c.Send("Операция изменения заметки заняла слишком много времени. Попробуйте позже.")
+			}
+			log.Printf("failed to update note '%d' for user '%d': %v", dialog.NoteID, userID, err)
+			return c.Send("Ошибка при изменении заметки. Попробуйте позже.")
+		}
+
+		if err = w.dialogs.Cancel(ctx, dialog.ChatID); err != nil {
+			log.Printf("failed to finish dialog for chat '%d': %v", dialog.ChatID, err)
+		}
+
+		return c.Send("Заметка успешно изменена")
+	})
+
+	w.handlers.Handle(&telebot.InlineButton{Unique: "edit_no"}, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		chatID := model.ChatID(c.Chat().ID)
+		if err := w.dialogs.Cancel(ctx, chatID); err != nil {
+			log.Printf("failed to cancel dialog for chat '%d': %v", chatID, err)
+		}
+
+		return c.Send("Изменения отменены")
+	})
+}
+
+// editText сохраняет новый текст редактируемой заметки
+func (w *Writer) editText(ctx context.Context, c telebot.Context, dialog *model.Dialog) error {
+	dialog.Text = c.Text()
+
+	if dialog.EditTarget == model.EditTargetBoth {
+		if err := w.advanceDialog(ctx, c, dialog, model.DialogStateEditTime); err != nil {
+			return err
+		}
+		return c.Send(editTimeMessage)
+	}
+
+	if err := w.advanceDialog(ctx, c, dialog, model.DialogStateConfirmEdit); err != nil {
+		return err
+	}
+	return w.sendEditConfirmation(ctx, c, dialog)
+}
+
+// editTime сохраняет новое время напоминания редактируемой заметки
+func (w *Writer) editTime(ctx context.Context, c telebot.Context, dialog *model.Dialog) error {
+	loc := w.userLocation(ctx, model.UserID(c.Sender().ID))
+
+	notifyAt, rest, err := timeparse.Parse(c.Text(), time.Now().In(loc))
+	if err != nil || rest != "" {
+		return c.Send(editTimeMessage)
+	}
+	if !notifyAt.After(time.Now()) {
+		return c.Send("Время напоминания уже прошло. Введите другое время:")
+	}
+
+	dialog.NotifyAt = notifyAt
+	if err = w.advanceDialog(ctx, c, dialog, model.DialogStateConfirmEdit); err != nil {
+		return err
+	}
+	return w.sendEditConfirmation(ctx, c, dialog)
+}
+
+// sendEditConfirmation спрашивает подтверждение изменения заметки
+func (w *Writer) sendEditConfirmation(ctx context.Context, c telebot.Context, dialog *model.Dialog) error {
+	loc := w.userLocation(ctx, model.UserID(c.Sender().ID))
+	markup := &telebot.ReplyMarkup{}
+	markup.InlineKeyboard = [][]telebot.InlineButton{
+		{
+			telebot.InlineButton{Unique: "edit_save", Text: "Да"},
+			telebot.InlineButton{Unique: "edit_no", Text: "Нет"},
+		},
+	}
+	return c.Send(fmt.Sprintf("Сохранить изменения: \"%s\" с напоминанием на %s?",
+		dialog.Text, dialog.NotifyAt.In(loc).Format("2006-01-02 15:04")), markup)
+}
+
+// repeatHandler обработчик задать правило повторения заметки
+func (w *Writer) repeatHandler() {
+	w.handlers.Handle("/repeat", func(c telebot.Context) error {
+		args := c.Args()
+		if len(args) < 2 {
+			return c.Send("Укажите id заметки и правило повторения, например: /repeat 12 weekly mon 09:00")
+		}
+
+		noteID, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Printf("failed to parse note id '%s': %v", args[0], err)
+			return c.Send("Не удалось преобразовать id заметки в числовое значение!")
+		}
+		userID := model.UserID(c.Sender().ID)
+
+		rule := ""
+		if args[1] != "off" {
+			parsed, err := recurrence.Parse(strings.Join(args[1:], " "))
+			if err != nil {
+				return c.Send(fmt.Sprintf("Не удалось разобрать правило повторения: %v", err))
+			}
+			rule = parsed.String()
+		}
+
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		if err = w.notes.SetRecurrence(ctx, model.NoteID(noteID), userID, rule); err != nil {
+			if errors.Is(err, model.ErrNoteNotFound) {
+				return c.Send(fmt.Sprintf("Заметка '%d' не найдена", noteID))
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("context deadline exceeded while set recurrence of note %d for user '%d': %v", noteID, userID, err)
+				return c.Send("Операция изменения заметки заняла слишком много времени. Попробуйте позже.")
+			}
+			log.Printf("failed to set recurrence of note '%d' for user '%d': %v", noteID, userID, err)
+			return c.Send("Ошибка при изменении заметки. Попробуйте позже.")
+		}
+
+		if rule == "" {
+			return c.Send("Повторение отключено")
+		}
+		return c.Send(fmt.Sprintf("Заметка будет повторяться: %s", rule))
+	})
+}
+
+// timezoneHandler обработчик задать часовой пояс пользователя
+func (w *Writer) timezoneHandler() {
+	w.handlers.Handle("/timezone", func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		args := c.Args()
+		if len(args) == 0 {
+			loc := w.userLocation(ctx, model.UserID(c.Sender().ID))
+			markup := &telebot.ReplyMarkup{ResizeKeyboard: true, OneTimeKeyboard: true}
+			markup.Reply(markup.Row(markup.Location("Отправить геопозицию")))
+			return c.Send(fmt.Sprintf("Ваш часовой пояс: %s. Укажите новый командой /timezone {зона} "+
+				"(например, /timezone Asia/Novosibirsk) или отправьте геопозицию.", loc), markup)
 		}
 
-		return c.Send(fmt.Sprintf("Сохранена заметка \"%s\", id: %d. Напоминание %s.", currentNote, noteID, selectedDateTime))
+		return w.setTimezone(ctx, c, args[0])
 	})
 
-	w.bot.Handle(&telebot.InlineButton{Unique: "save_no"}, func(c telebot.Context) error {
-		currentNote = ""
-		selectedDateTime = ""
-		selectedMonth = 0
-		selectedDay = 0
-		return c.Send("Напечатайте новую заметку:", &telebot.ReplyMarkup{ForceReply: true})
+	w.handlers.Handle(telebot.OnLocation, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		location := c.Message().Location
+		if location == nil {
+			return nil
+		}
+
+		return w.setTimezone(ctx, c, timezoneByLongitude(location.Lng))
 	})
 }
 
+// tokenHandler обработчик выпустить или отозвать токены REST API
+func (w *Writer) tokenHandler() {
+	w.handlers.Handle("/token", func(c telebot.Context) error {
+		// Токен дает доступ ко всем заметкам, в групповом чате его увидят другие участники
+		if c.Chat() == nil || c.Chat().Type != telebot.ChatPrivate {
+			return c.Send("Команда /token доступна только в личном чате с ботом")
+		}
+
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+		defer cancel()
+
+		userID := model.UserID(c.Sender().ID)
+
+		if args := c.Args(); len(args) > 0 {
+			if args[0] != "revoke" {
+				return c.Send("Используйте /token для нового токена или /token revoke, чтобы отозвать все токены")
+			}
+			revoked, err := w.tokens.Revoke(ctx, userID)
+			if err != nil {
+				log.Printf("failed to revoke api tokens of user '%d': %v", userID, err)
+				return c.Send("Не удалось отозвать токены. Попробуйте позже.")
+			}
+			return c.Send(fmt.Sprintf("Отозвано токенов: %d", revoked))
+		}
+
+		if err := w.notes.EnsureUserExists(ctx, model.User{ID: userID, Login: c.Sender().Username}); err != nil {
+			log.Printf("failed to ensure user '%d' exists: %v", userID, err)
+			return c.Send(fmt.Sprintf("Не удалось сохранить текущего пользователя '%d'", userID))
+		}
+
+		token, err := w.tokens.Issue(ctx, userID)
+		if err != nil {
+			log.Printf("failed to issue api token for user '%d': %v", userID, err)
+			return c.Send("Не удалось выпустить токен. Попробуйте позже.")
+		}
+
+		log.Printf("api token issued for user '%d'", userID)
+		return c.Send(fmt.Sprintf("Токен для REST API (показывается один раз, передавайте в заголовке "+
+			"Authorization: Bearer {токен}):\n\n<code>%s</code>", token), telebot.ModeHTML)
+	})
+}
+
+func (w *Writer) setTimezone(ctx context.Context, c telebot.Context, timezone string) error {
+	userID := model.UserID(c.Sender().ID)
+
+	if err := w.notes.SetTimezone(ctx, model.User{ID: userID, Login: c.Sender().Username}, timezone); err != nil {
+		if errors.Is(err, model.ErrInvalidTimezone) {
+			return c.Send(fmt.Sprintf("Неизвестный часовой пояс '%s'. Используйте имя из базы IANA, например Europe/Samara", timezone))
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("context deadline exceeded while set timezone for user '%d': %v", userID, err)
+			return c.Send("Операция сохранения часового пояса заняла слишком много времени. Попробуйте позже.")
+		}
+		log.Printf("failed to set timezone '%s' for user '%d': %v", timezone, userID, err)
+		return c.Send("Ошибка при сохранении часового пояса. Попробуйте позже.")
+	}
+
+	return c.Send(fmt.Sprintf("Часовой пояс установлен: %s", timezone), &telebot.ReplyMarkup{RemoveKeyboard: true})
+}
+
 // deleteHandler обработчик удалить заметку
 func (w *Writer) deleteHandler() {
-	w.bot.Handle("/delete", func(c telebot.Context) error {
+	w.handlers.Handle("/delete", func(c telebot.Context) error {
 		args := c.Args()
 		if len(args) == 0 {
 			return c.Send("Не указан id заметки!")
@@ -213,7 +741,7 @@ func (w *Writer) deleteHandler() {
 		}
 		userID := model.UserID(c.Sender().ID)
 
-		ctx, cancel := context.WithTimeout(context.Background(), longProcessTimeout*time.Second)
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
 		defer cancel()
 
 		if err = w.notes.Delete(ctx, model.NoteID(noteID), userID); err != nil {
@@ -234,7 +762,7 @@ func (w *Writer) deleteHandler() {
 
 // getHandler обработчик получить заметку
 func (w *Writer) getHandler() {
-	w.bot.Handle("/get", func(c telebot.Context) error {
+	w.handlers.Handle("/get", func(c telebot.Context) error {
 		args := c.Args()
 		if len(args) == 0 {
 			return c.Send("Не указан id заметки!")
@@ -247,7 +775,7 @@ func (w *Writer) getHandler() {
 		}
 		userID := model.UserID(c.Sender().ID)
 
-		ctx, cancel := context.WithTimeout(context.Background(), longProcessTimeout*time.Second)
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
 		defer cancel()
 
 		note, err := w.notes.Get(ctx, model.NoteID(noteID), userID)
@@ -263,13 +791,16 @@ func (w *Writer) getHandler() {
 			return c.Send("Ошибка при получении заметки. Попробуйте позже.")
 		}
 
-		messageDel := "нет"
-		if note.DeletedAt != nil {
-			messageDel = note.DeletedAt.Format("2006-01-02 15:04")
+		loc := w.userLocation(ctx, userID)
+
+		messageRepeat := "нет"
+		if note.Recurrence != "" {
+			messageRepeat = note.Recurrence
 		}
 
-		message := fmt.Sprintf("%s (id %d, создана: %s, напоминание: %s, удалена: %s)",
-			note.Text, note.ID, note.CreatedAt.Format("2006-01-02 15:04"), note.NotifyAt.Format("2006-01-02 15:04"), messageDel)
+		message := fmt.Sprintf("%s (id %d, создана: %s, напоминание: %s, повтор: %s, статус: %s, попыток отправки: %d)",
+			note.Text, note.ID, note.CreatedAt.In(loc).Format("2006-01-02 15:04"), note.NotifyAt.In(loc).Format("2006-01-02 15:04"),
+			messageRepeat, statusText(*note, loc), note.Attempts)
 
 		return c.Send(message)
 	})
@@ -277,7 +808,7 @@ func (w *Writer) getHandler() {
 
 // listNoteHandler обработчик получить список заметок
 func (w *Writer) listNoteHandler() {
-	w.bot.Handle("/list", func(c telebot.Context) error {
+	w.handlers.Handle("/list", func(c telebot.Context) error {
 		userID := model.UserID(c.Sender().ID)
 		showDeleted := false
 
@@ -287,7 +818,7 @@ func (w *Writer) listNoteHandler() {
 			showDeleted = true
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), longProcessTimeout*time.Second)
+		ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
 		defer cancel()
 
 		ctx, span := tracing.StartSpan(ctx, "listNoteHandler_app")
@@ -308,29 +839,186 @@ func (w *Writer) listNoteHandler() {
 		}
 
 		var (
-			response     strings.Builder
-			firstDeleted = true
+			response      strings.Builder
+			firstFinished = true
+			loc           = w.userLocation(ctx, userID)
 		)
 		response.WriteString("Активные заметки:\n")
 		for i, note := range notesList {
 			status := ""
-			if note.DeletedAt != nil {
-				if firstDeleted {
-					firstDeleted = false
-					response.WriteString("\nУдаленные заметки:\n")
+			if note.Status != model.NoteStatusPending {
+				if firstFinished {
+					firstFinished = false
+					response.WriteString("\nЗавершенные заметки:\n")
 				}
 
-				status = fmt.Sprintf(" (Удалена %s)", note.DeletedAt.Format("2006-01-02 15:04"))
+				status = fmt.Sprintf(" (%s)", statusText(note, loc))
 			}
 
-			response.WriteString(fmt.Sprintf("%d. %s. (id %d. Напоминание: %s)%s\n",
-				i+1, note.Text, note.ID, note.NotifyAt.Format("2006-01-02 15:04"), status))
+			repeat := ""
+			if note.Recurrence != "" {
+				repeat = fmt.Sprintf(". Повтор: %s", note.Recurrence)
+			}
+
+			response.WriteString(fmt.Sprintf("%d. %s. (id %d. Напоминание: %s%s)%s\n",
+				i+1, note.Text, note.ID, note.NotifyAt.In(loc).Format("2006-01-02 15:04"), repeat, status))
 		}
 
 		return c.Send(response.String())
 	})
 }
 
+// getDialog возвращает текущий диалог чата или nil, если диалога нет
+func (w *Writer) getDialog(ctx context.Context, c telebot.Context) (*model.Dialog, error) {
+	chatID := model.ChatID(c.Chat().ID)
+
+	dialog, err := w.dialogs.Get(ctx, chatID)
+	if err != nil {
+		if errors.Is(err, model.ErrDialogNotFound) {
+			return nil, nil
+		}
+		if errors.Is(err, model.ErrDialogExpired) {
+			return nil, c.Send("Время ожидания истекло. Начните заново командой /new")
+		}
+		log.Printf("failed to get dialog for chat '%d': %v", chatID, err)
+		return nil, c.Send("Ошибка при обработке заметки. Попробуйте позже.")
+	}
+
+	return dialog, nil
+}
+
+// advanceDialog переводит диалог в состояние to и сохраняет его
+func (w *Writer) advanceDialog(ctx context.Context, c telebot.Context, dialog *model.Dialog, to model.DialogState) error {
+	if err := dialog.Transition(to); err != nil {
+		return c.Send("Это действие сейчас недоступно. Продолжите текущий шаг или отмените его командой /cancel")
+	}
+
+	if err := w.dialogs.Save(ctx, *dialog); err != nil {
+		log.Printf("failed to save dialog for chat '%d': %v", dialog.ChatID, err)
+		return c.Send("Ошибка при обработке заметки. Попробуйте позже.")
+	}
+
+	return nil
+}
+
+// restartDialog начинает ввод текста заметки заново
+func (w *Writer) restartDialog(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(tracing.Context(c), longProcessTimeout*time.Second)
+	defer cancel()
+
+	dialog, err := w.getDialog(ctx, c)
+	if err != nil || dialog == nil {
+		return err
+	}
+
+	dialog.Text = ""
+	dialog.Month = 0
+	dialog.Day = 0
+	dialog.NotifyAt = time.Time{}
+	if err = w.advanceDialog(ctx, c, dialog, model.DialogStateAwaitingText); err != nil {
+		return err
+	}
+
+	return c.Send("Напечатайте новую заметку:", &telebot.ReplyMarkup{ForceReply: true})
+}
+
+// selectDay сохраняет выбранный день месяца
+func (w *Writer) selectDay(ctx context.Context, c telebot.Context, dialog *model.Dialog, input string) error {
+	daysInMonth := time.Date(time.Now().Year(), dialog.Month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	day, err := strconv.Atoi(input)
+	if err != nil || day < 1 || day > daysInMonth {
+		return c.Send("Введите корректный день месяца:")
+	}
+
+	dialog.Day = day
+	if err = w.advanceDialog(ctx, c, dialog, model.DialogStateAwaitingTime); err != nil {
+		return err
+	}
+
+	return c.Send("Введите время в формате HH или HH:MM (например, 14 или 15:37):")
+}
+
+// statusText описание статуса заметки для пользователя
+func statusText(note model.Note, loc *time.Location) string {
+	formatAt := func(at *time.Time) string {
+		if at == nil {
+			return ""
+		}
+		return " " + at.In(loc).Format("2006-01-02 15:04")
+	}
+
+	switch note.Status {
+	case model.NoteStatusPending:
+		return "ожидает отправки"
+	case model.NoteStatusSent:
+		return "отправлена" + formatAt(note.SentAt)
+	case model.NoteStatusAcknowledged:
+		return "выполнена" + formatAt(note.AcknowledgedAt)
+	case model.NoteStatusCancelled:
+		return "удалена" + formatAt(note.DeletedAt)
+	case model.NoteStatusFailed:
+		return "не доставлена"
+	}
+	return string(note.Status)
+}
+
+// warnUndeliverable предупреждает пользователя, если бот notifier не может отправить ему напоминание
+func (w *Writer) warnUndeliverable(ctx context.Context, c telebot.Context) error {
+	userID := model.UserID(c.Sender().ID)
+	state, err := w.notes.DeliveryState(ctx, userID)
+	if err != nil {
+		log.Printf("failed to get delivery state of user '%d': %v", userID, err)
+		return nil
+	}
+
+	if w.notifierLink == "" {
+		// Один бот: раз пользователь пишет боту, напоминания до него дойдут
+		if state.Paused() {
+			_, err = w.notes.SetDeliveryState(ctx, model.User{ID: userID, Login: c.Sender().Username}, model.DeliveryStateActive, "")
+			if err != nil {
+				log.Printf("failed to activate delivery for user '%d': %v", userID, err)
+			}
+		}
+		return nil
+	}
+
+	var warning string
+	switch state {
+	case model.DeliveryStateBlocked:
+		warning = "Бот напоминаний заблокирован, напоминания приостановлены. Разблокируйте его и нажмите Start: "
+	case model.DeliveryStateChatNotFound, model.DeliveryStateUnknown:
+		warning = "Напоминания приходят от отдельного бота. Если вы еще не запускали его, откройте ссылку и нажмите Start: "
+	default:
+		return nil
+	}
+
+	return c.Send(warning+w.notifierLink, telebot.NoPreview)
+}
+
+// userLocation возвращает часовой пояс пользователя, при ошибке - часовой пояс по умолчанию
+func (w *Writer) userLocation(ctx context.Context, userID model.UserID) *time.Location {
+	loc, err := w.notes.UserLocation(ctx, userID)
+	if err != nil {
+		log.Printf("failed to get time zone of user '%d': %v", userID, err)
+		loc, _ = time.LoadLocation(model.DefaultTimezone)
+	}
+	return loc
+}
+
+// sendSaveConfirmation спрашивает подтверждение сохранения заметки
+func (w *Writer) sendSaveConfirmation(c telebot.Context, dialog *model.Dialog, loc *time.Location) error {
+	markup := &telebot.ReplyMarkup{}
+	markup.InlineKeyboard = [][]telebot.InlineButton{
+		{
+			telebot.InlineButton{Unique: "save_yes", Text: "Да"},
+			telebot.InlineButton{Unique: "save_no", Text: "Нет"},
+		},
+	}
+	return c.Send(fmt.Sprintf("Сохранить заметку: \"%s\" с напоминанием на %s?",
+		dialog.Text, dialog.NotifyAt.In(loc).Format("2006-01-02 15:04")), markup)
+}
+
 func (w *Writer) sendDays(c telebot.Context, selectedMonth time.Month) error {
 	year := time.Now().Year()
 	daysInMonth := time.Date(year, selectedMonth+1, 0, 0, 0, 0, 0, time.UTC).Day()
@@ -354,6 +1042,17 @@ func (w *Writer) sendDays(c telebot.Context, selectedMonth time.Month) error {
 	return c.Send("Выберите день:", markup)
 }
 
+// nextMonthDay ближайший после now момент day.month в hour:minute по часовому поясу now.
+// Прошедшая в этом году дата переносится на следующий год, 29 февраля - на ближайший високосный.
+func nextMonthDay(now time.Time, month time.Month, day, hour, minute int) time.Time {
+	for year := now.Year(); ; year++ {
+		at := time.Date(year, month, day, hour, minute, 0, 0, now.Location())
+		if at.Month() == month && at.After(now) {
+			return at
+		}
+	}
+}
+
 func isValidTimeFormat(input string) bool {
 	if _, err := time.Parse("15", input); err == nil {
 		return true
@@ -370,3 +1069,18 @@ func formatTime(input string) string {
 	}
 	return input + ":00"
 }
+
+// timezoneByLongitude приближенно определяет часовой пояс по долготе (15° на час).
+// Зоны Etc/GMT не учитывают летнее время, при необходимости пользователь может указать зону IANA вручную.
+func timezoneByLongitude(lng float32) string {
+	offset := int(math.Round(float64(lng) / 15))
+	switch {
+	case offset == 0:
+		return "Etc/GMT"
+	case offset > 0:
+		// В зонах Etc/GMT знак инвертирован: Etc/GMT-3 = UTC+3
+		return fmt.Sprintf("Etc/GMT-%d", offset)
+	default:
+		return fmt.Sprintf("Etc/GMT+%d", -offset)
+	}
+}
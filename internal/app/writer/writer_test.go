@@ -0,0 +1,35 @@
+package writer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextMonthDay(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	// 15 мая 2024 года, 10:30
+	now := time.Date(2024, time.May, 15, 10, 30, 0, 0, loc)
+
+	tests := []struct {
+		name         string
+		month        time.Month
+		day          int
+		hour, minute int
+		want         time.Time
+	}{
+		{"later this year", time.December, 31, 9, 0, time.Date(2024, time.December, 31, 9, 0, 0, 0, loc)},
+		{"later today", time.May, 15, 11, 0, time.Date(2024, time.May, 15, 11, 0, 0, 0, loc)},
+		{"earlier today", time.May, 15, 10, 30, time.Date(2025, time.May, 15, 10, 30, 0, 0, loc)},
+		{"earlier this year", time.January, 10, 9, 0, time.Date(2025, time.January, 10, 9, 0, 0, 0, loc)},
+		{"leap day", time.February, 29, 9, 0, time.Date(2028, time.February, 29, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextMonthDay(now, tt.month, tt.day, tt.hour, tt.minute)
+			if !got.Equal(tt.want) {
+				t.Errorf("nextMonthDay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package bootstrap общий запуск процессов из cmd: остановка по сигналу, БД, миграции, бот и kafka
+package bootstrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/infrastructure/health"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/infrastructure/telegram"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/config"
+	dialog_repo "github.com/kotche/bot/internal/repository/dialog"
+	"github.com/kotche/bot/internal/service/kafka"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+
+	"gopkg.in/telebot.v3"
+)
+
+// SignalContext отменяется по SIGINT или SIGTERM. Если после сигнала процесс не завершился
+// за timeout, он завершается принудительно.
+func SignalContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go EnforceShutdownDeadline(ctx, timeout)
+	return ctx, stop
+}
+
+// EnforceShutdownDeadline завершает процесс, если после сигнала остановка заняла больше timeout
+func EnforceShutdownDeadline(ctx context.Context, timeout time.Duration) {
+	<-ctx.Done()
+	log.Printf("shutting down, deadline %s", timeout)
+
+	time.Sleep(timeout)
+	log.Fatalf("shutdown deadline %s exceeded", timeout)
+}
+
+// OpenDB открывает пул соединений с postgres, регистрирует его метрики и проверку готовности
+func OpenDB(cfg config.PostgresConfig, checks *health.Checks) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connString(cfg))
+	if err != nil {
+		return nil, err
+	}
+	metrics.RegisterDBStats(db, cfg.DBName)
+	checks.Add("postgres", db.PingContext)
+
+	return db, nil
+}
+
+// RunMigrations применяет миграции из каталога migrations
+func RunMigrations(cfg config.PostgresConfig) error {
+	m, err := migrate.New(
+		"file://migrations",
+		connString(cfg),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to init migrations: %w", err)
+	}
+
+	if err = m.Up(); !errors.Is(err, migrate.ErrNoChange) && err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	return nil
+}
+
+// connString URL подключения к postgres; логин и пароль экранируются
+func connString(cfg config.PostgresConfig) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.DBName,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// NewBot создает бота, получающего обновления по TELEGRAM_MODE, и регистрирует проверку готовности.
+// В режиме webhook адрес регистрируется в telegram сразу, ошибка регистрации возвращается.
+func NewBot(token string, cfg config.TelegramConfig, webhook config.WebhookConfig, checks *health.Checks) (*telebot.Bot, error) {
+	opts := telegram.Options{
+		Mode:        cfg.Mode,
+		PollTimeout: cfg.PollTimeout,
+		Webhook:     telegram.WebhookOptions(webhook),
+	}
+	poller := health.NewPoller(telegram.NewPoller(opts))
+	checks.Add("telegram", poller.Check)
+
+	bot, err := telebot.NewBot(telebot.Settings{
+		Token:  token,
+		Poller: poller,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Mode == telegram.ModeWebhook {
+		if err = telegram.SetWebhook(bot, opts.Webhook); err != nil {
+			return nil, err
+		}
+	}
+	return bot, nil
+}
+
+// InitTracing настраивает трассировку процесса serviceName, возвращает функцию сброса спанов
+func InitTracing(cfg config.TracingConfig, serviceName string) (func(), error) {
+	_, cleanup, err := tracing.InitTracing(tracing.Options(cfg), serviceName)
+	return cleanup, err
+}
+
+// NewKafka подключается к топику; groupID пустой, если процесс из топика не читает
+func NewKafka(cfg config.KafkaConfig, topic, groupID string) (*kafka.Service, error) {
+	return kafka.New(cfg.Brokers, topic, groupID, 1, 1)
+}
+
+// DialogRepository хранилище диалогов по DIALOG_STORAGE
+func DialogRepository(cfg config.DialogConfig, db *sql.DB) (dialog_repo.Repository, error) {
+	switch cfg.Storage {
+	case "memory":
+		return dialog_repo.NewMemoryRepository(), nil
+	case "postgres":
+		return dialog_repo.NewInstrumentedRepository(dialog_repo.NewDefaultRepository(db)), nil
+	}
+	return nil, fmt.Errorf("unknown dialog storage '%s'", cfg.Storage)
+}
@@ -0,0 +1,45 @@
+package bootstrap
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/kotche/bot/internal/config"
+)
+
+func TestConnString(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "db",
+		Port:     "5432",
+		User:     "bot",
+		Password: "secret",
+		DBName:   "notes",
+		SSLMode:  "disable",
+	}
+	if got, want := connString(cfg), "postgres://bot:secret@db:5432/notes?sslmode=disable"; got != want {
+		t.Fatalf("connString() = %q, want %q", got, want)
+	}
+}
+
+func TestConnStringEscapesCredentials(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "db",
+		Port:     "5432",
+		User:     "bot@team",
+		Password: "p@ss:w/rd?#%",
+		DBName:   "notes",
+		SSLMode:  "require",
+	}
+
+	dsn, err := url.Parse(connString(cfg))
+	if err != nil {
+		t.Fatalf("connString() is not a valid URL: %v", err)
+	}
+	password, _ := dsn.User.Password()
+	if dsn.User.Username() != cfg.User || password != cfg.Password {
+		t.Fatalf("credentials = %q, %q, want %q, %q", dsn.User.Username(), password, cfg.User, cfg.Password)
+	}
+	if dsn.Host != "db:5432" || dsn.Path != "/notes" || dsn.Query().Get("sslmode") != "require" {
+		t.Fatalf("dsn = %s", dsn)
+	}
+}
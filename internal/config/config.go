@@ -4,20 +4,62 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	TelegramConfig TelegramConfig
-	PostgresConfig PostgresConfig
-	KafkaConfig    KafkaConfig
-	TracingConfig  TracingConfig
+	// ShutdownTimeout за сколько процесс должен завершиться после SIGTERM
+	ShutdownTimeout time.Duration
+	HTTPConfig      HTTPConfig
+	TelegramConfig  TelegramConfig
+	PostgresConfig  PostgresConfig
+	KafkaConfig     KafkaConfig
+	TracingConfig   TracingConfig
+	DialogConfig    DialogConfig
+	NotifierConfig  NotifierConfig
+	APIConfig       APIConfig
+}
+
+// HTTPConfig http сервер метрик и проверок состояния
+type HTTPConfig struct {
+	WriterAddr   string
+	NotifierAddr string
+	APIAddr      string
+	// Pprof включает /debug/pprof
+	Pprof bool
+	// ShutdownTimeout сколько ждать завершения текущих запросов при остановке
+	ShutdownTimeout time.Duration
 }
 
 type TelegramConfig struct {
+	// Token единственный бот для cmd/allinone, заменяет TokenWriteBot и TokenNotifyBot
+	Token          string
 	TokenWriteBot  string
 	TokenNotifyBot string
+	// NotifyBotUsername имя бота notifier для ссылки активации, если не задано - запрашивается у telegram
+	NotifyBotUsername string
+	// Mode способ получения обновлений: polling или webhook
+	Mode        string
+	PollTimeout time.Duration
+	// WriterWebhook и NotifierWebhook настройки webhook процессов writer и notifier, allinone использует WriterWebhook
+	WriterWebhook   WebhookConfig
+	NotifierWebhook WebhookConfig
+}
+
+type WebhookConfig struct {
+	// Addr адрес, на котором слушает webhook-сервер
+	Addr string
+	// PublicURL адрес, который регистрируется в telegram. Если пустой, webhook не регистрируется
+	// и обновления можно присылать на Addr вручную
+	PublicURL string
+	// Secret сверяется с заголовком X-Telegram-Bot-Api-Secret-Token
+	Secret string
+	// TLSCert и TLSKey пути к сертификату и ключу, без них сервер слушает HTTP (TLS на балансировщике)
+	TLSCert string
+	TLSKey  string
 }
 
 type PostgresConfig struct {
@@ -30,13 +72,60 @@ type PostgresConfig struct {
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	Topic   string
-	GroupID string
+	Brokers  []string
+	Topic    string
+	GroupID  string
+	DLQTopic string
 }
 
 type TracingConfig struct {
+	// Exporter jaeger, otlp-grpc, otlp-http, stdout, file или none
+	Exporter string
+	// Endpoint адрес коллектора, для otlp пустой - адрес по умолчанию
 	Endpoint string
+	Insecure bool
+	// File файл для экспортера file
+	File string
+	// SampleRatio доля сохраняемых трасс от 0 до 1
+	SampleRatio float64
+	// ParentBased сэмплировать по решению родительского спана, если он есть
+	ParentBased    bool
+	ServiceVersion string
+}
+
+type NotifierConfig struct {
+	// MaxLateness насколько поздно еще можно доставить пропущенное напоминание, 0 - без ограничения
+	MaxLateness time.Duration
+	// InstanceID владелец захваченных напоминаний и сообщений outbox, уникален для каждого экземпляра notifier
+	InstanceID     string
+	ClaimLease     time.Duration
+	ClaimBatchSize int
+	// ConsumerBatchSize и ConsumerFlushInterval сколько сообщений о доставке копить и как долго ждать
+	// до записи партии в БД
+	ConsumerBatchSize     int
+	ConsumerFlushInterval time.Duration
+	// ConsumerMaxRetries попыток записи партии в БД, после них сообщения уходят в dead-letter топик
+	ConsumerMaxRetries int
+	// FlushTimeout сколько после остановки дописывается собранная партия, половина SHUTDOWN_TIMEOUT
+	FlushTimeout time.Duration
+	// SendRate и ChatSendRate лимиты отправки в telegram в сообщениях в секунду: всего и в один чат
+	SendRate     float64
+	ChatSendRate float64
+	// SendRetries повторов отправки при временной ошибке telegram
+	SendRetries int
+	SendWorkers int
+	// OutboxRetention сколько хранить опубликованные сообщения outbox, 0 - не удалять
+	OutboxRetention time.Duration
+}
+
+type APIConfig struct {
+	// Addr адрес REST API, метрики и проверки здоровья cmd/api отдает на HTTPConfig.APIAddr
+	Addr string
+}
+
+type DialogConfig struct {
+	Storage string // memory или postgres
+	TTL     time.Duration
 }
 
 func LoadConfig() (*Config, error) {
@@ -45,9 +134,22 @@ func LoadConfig() (*Config, error) {
 	}
 
 	config := &Config{
+		HTTPConfig: HTTPConfig{
+			WriterAddr:   getEnv("WRITER_HTTP_ADDR", ":8080"),
+			NotifierAddr: getEnv("NOTIFIER_HTTP_ADDR", ":8081"),
+			APIAddr:      getEnv("API_HTTP_ADDR", ":8082"),
+		},
+		APIConfig: APIConfig{
+			Addr: getEnv("API_ADDR", ":8090"),
+		},
 		TelegramConfig: TelegramConfig{
-			TokenWriteBot:  getEnv("TOKEN_WRITE_BOT", ""),
-			TokenNotifyBot: getEnv("TOKEN_NOTIFY_BOT", ""),
+			Token:             getEnv("TOKEN_BOT", ""),
+			TokenWriteBot:     getEnv("TOKEN_WRITE_BOT", ""),
+			TokenNotifyBot:    getEnv("TOKEN_NOTIFY_BOT", ""),
+			NotifyBotUsername: getEnv("NOTIFY_BOT_USERNAME", ""),
+			Mode:              getEnv("TELEGRAM_MODE", "polling"),
+			WriterWebhook:     loadWebhookConfig("WRITER", ":8443"),
+			NotifierWebhook:   loadWebhookConfig("NOTIFIER", ":8444"),
 		},
 		PostgresConfig: PostgresConfig{
 			Host:     getEnv("POSTGRES_HOST", "localhost"),
@@ -58,29 +160,197 @@ func LoadConfig() (*Config, error) {
 			SSLMode:  getEnv("POSTGRES_SSLMODE", "disable"),
 		},
 		KafkaConfig: KafkaConfig{
-			Brokers: []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
-			Topic:   getEnv("KAFKA_TOPIC", "notifications"),
-			GroupID: getEnv("KAFKA_GROUP_ID", "notification-consumers"),
+			Brokers:  []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
+			Topic:    getEnv("KAFKA_TOPIC", "notifications"),
+			GroupID:  getEnv("KAFKA_GROUP_ID", "notification-consumers"),
+			DLQTopic: getEnv("KAFKA_DLQ_TOPIC", "notifications-dlq"),
 		},
 		TracingConfig: TracingConfig{
-			Endpoint: getEnv("TRACING_ENDPOINT", "http://localhost:14268/api/traces"),
+			Exporter:       getEnv("TRACING_EXPORTER", "otlp-grpc"),
+			File:           getEnv("TRACING_FILE", "traces.json"),
+			ServiceVersion: getEnv("SERVICE_VERSION", "dev"),
+		},
+		DialogConfig: DialogConfig{
+			Storage: getEnv("DIALOG_STORAGE", "postgres"),
 		},
 	}
 
-	if config.TelegramConfig.TokenWriteBot == "" {
-		return nil, fmt.Errorf("TOKEN_WRITE_BOT is required")
+	defaultTracingEndpoint := ""
+	if config.TracingConfig.Exporter == "jaeger" {
+		defaultTracingEndpoint = "http://localhost:14268/api/traces"
+	}
+	config.TracingConfig.Endpoint = getEnv("TRACING_ENDPOINT", defaultTracingEndpoint)
+
+	var err error
+	if config.TracingConfig.Insecure, err = getEnvBool("TRACING_INSECURE", true); err != nil {
+		return nil, err
+	}
+	if config.TracingConfig.SampleRatio, err = getEnvFloat("TRACING_SAMPLE_RATIO", 1); err != nil {
+		return nil, err
+	}
+	if config.TracingConfig.SampleRatio < 0 || config.TracingConfig.SampleRatio > 1 {
+		return nil, fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+	if config.TracingConfig.ParentBased, err = getEnvBool("TRACING_SAMPLER_PARENT_BASED", true); err != nil {
+		return nil, err
+	}
+
+	if config.ShutdownTimeout, err = getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	config.NotifierConfig.FlushTimeout = config.ShutdownTimeout / 2
+	if config.TelegramConfig.PollTimeout, err = getEnvDuration("TELEGRAM_POLL_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	switch config.TelegramConfig.Mode {
+	case "polling", "webhook":
+	default:
+		return nil, fmt.Errorf("unknown TELEGRAM_MODE '%s'", config.TelegramConfig.Mode)
+	}
+	// Без секрета любой, кто знает адрес webhook, может присылать боту поддельные обновления
+	if config.TelegramConfig.Mode == "webhook" && config.TelegramConfig.WriterWebhook.Secret == "" {
+		return nil, fmt.Errorf("TELEGRAM_WEBHOOK_SECRET is required when TELEGRAM_MODE is webhook")
+	}
+	if (config.TelegramConfig.WriterWebhook.TLSCert == "") != (config.TelegramConfig.WriterWebhook.TLSKey == "") {
+		return nil, fmt.Errorf("TELEGRAM_WEBHOOK_TLS_CERT and TELEGRAM_WEBHOOK_TLS_KEY must be set together")
+	}
+	if config.HTTPConfig.Pprof, err = getEnvBool("HTTP_PPROF", false); err != nil {
+		return nil, err
+	}
+	if config.HTTPConfig.ShutdownTimeout, err = getEnvDuration("HTTP_SHUTDOWN_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
 	}
 
-	if config.TelegramConfig.TokenNotifyBot == "" {
-		return nil, fmt.Errorf("TOKEN_NOTIFY_BOT is required")
+	dialogTTL, err := getEnvDuration("DIALOG_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	config.DialogConfig.TTL = dialogTTL
+
+	maxLateness, err := getEnvDuration("NOTIFIER_MAX_LATENESS", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	config.NotifierConfig.MaxLateness = maxLateness
+
+	hostname, _ := os.Hostname()
+	config.NotifierConfig.InstanceID = getEnv("NOTIFIER_INSTANCE_ID", fmt.Sprintf("%s-%d", hostname, os.Getpid()))
+
+	if config.NotifierConfig.ClaimLease, err = getEnvDuration("NOTIFIER_CLAIM_LEASE", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.ClaimBatchSize, err = getEnvInt("NOTIFIER_CLAIM_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.ClaimBatchSize <= 0 {
+		return nil, fmt.Errorf("NOTIFIER_CLAIM_BATCH_SIZE must be positive")
+	}
+	if config.NotifierConfig.ConsumerBatchSize, err = getEnvInt("NOTIFIER_CONSUMER_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.ConsumerBatchSize <= 0 {
+		return nil, fmt.Errorf("NOTIFIER_CONSUMER_BATCH_SIZE must be positive")
+	}
+	if config.NotifierConfig.ConsumerFlushInterval, err = getEnvDuration("NOTIFIER_CONSUMER_FLUSH_INTERVAL", 500*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.ConsumerMaxRetries, err = getEnvInt("NOTIFIER_CONSUMER_MAX_RETRIES", 5); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.ConsumerMaxRetries <= 0 {
+		return nil, fmt.Errorf("NOTIFIER_CONSUMER_MAX_RETRIES must be positive")
+	}
+	if config.NotifierConfig.SendRate, err = getEnvFloat("NOTIFIER_SEND_RATE", 30); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.ChatSendRate, err = getEnvFloat("NOTIFIER_CHAT_SEND_RATE", 1); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.SendRate <= 0 || config.NotifierConfig.ChatSendRate <= 0 {
+		return nil, fmt.Errorf("NOTIFIER_SEND_RATE and NOTIFIER_CHAT_SEND_RATE must be positive")
+	}
+	if config.NotifierConfig.SendRetries, err = getEnvInt("NOTIFIER_SEND_RETRIES", 3); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.SendWorkers, err = getEnvInt("NOTIFIER_SEND_WORKERS", 8); err != nil {
+		return nil, err
+	}
+	if config.NotifierConfig.SendWorkers <= 0 {
+		return nil, fmt.Errorf("NOTIFIER_SEND_WORKERS must be positive")
+	}
+	if config.NotifierConfig.OutboxRetention, err = getEnvDuration("NOTIFIER_OUTBOX_RETENTION", 7*24*time.Hour); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
 
+// loadWebhookConfig адрес и URL задаются для процесса (WRITER_WEBHOOK_ADDR), секрет и сертификат общие
+func loadWebhookConfig(process, defaultAddr string) WebhookConfig {
+	return WebhookConfig{
+		Addr:      getEnv(process+"_WEBHOOK_ADDR", defaultAddr),
+		PublicURL: getEnv(process+"_WEBHOOK_URL", ""),
+		Secret:    getEnv("TELEGRAM_WEBHOOK_SECRET", ""),
+		TLSCert:   getEnv("TELEGRAM_WEBHOOK_TLS_CERT", ""),
+		TLSKey:    getEnv("TELEGRAM_WEBHOOK_TLS_KEY", ""),
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration in %s: %w", key, err)
+	}
+	return duration, nil
+}
+
+func getEnvFloat(key string, defaultValue float64) (float64, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number in %s: %w", key, err)
+	}
+	return number, nil
+}
+
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean in %s: %w", key, err)
+	}
+	return flag, nil
+}
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number in %s: %w", key, err)
+	}
+	return number, nil
+}
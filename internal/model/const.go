@@ -3,4 +3,38 @@ package model
 type (
 	UserID int64
 	NoteID int64
+	ChatID int64
+)
+
+type NoteStatus string
+
+const (
+	NoteStatusPending      NoteStatus = "pending"
+	NoteStatusSent         NoteStatus = "sent"
+	NoteStatusAcknowledged NoteStatus = "acknowledged"
+	NoteStatusCancelled    NoteStatus = "cancelled"
+	NoteStatusFailed       NoteStatus = "failed"
+)
+
+// DeliveryState можно ли доставить пользователю напоминание через бота notifier
+type DeliveryState string
+
+const (
+	// DeliveryStateUnknown пользователю еще ничего не отправлялось
+	DeliveryStateUnknown DeliveryState = "unknown"
+	DeliveryStateActive  DeliveryState = "active"
+	// DeliveryStateBlocked пользователь заблокировал бота или удалил аккаунт
+	DeliveryStateBlocked DeliveryState = "blocked"
+	// DeliveryStateChatNotFound пользователь не запускал бота (не нажимал Start)
+	DeliveryStateChatNotFound DeliveryState = "chat_not_found"
+)
+
+// Paused отправка напоминаний приостановлена до повторного запуска бота пользователем
+func (s DeliveryState) Paused() bool {
+	return s == DeliveryStateBlocked || s == DeliveryStateChatNotFound
+}
+
+const (
+	// DefaultTimezone часовой пояс пользователей, которые не указали свой
+	DefaultTimezone = "Europe/Moscow"
 )
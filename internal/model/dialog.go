@@ -0,0 +1,74 @@
+package model
+
+import "time"
+
+type DialogState string
+
+const (
+	DialogStateAwaitingText  DialogState = "awaiting_text"
+	DialogStateConfirmText   DialogState = "confirm_text"
+	DialogStateAwaitingMonth DialogState = "awaiting_month"
+	DialogStateAwaitingDay   DialogState = "awaiting_day"
+	DialogStateAwaitingTime  DialogState = "awaiting_time"
+	DialogStateConfirmSave   DialogState = "confirm_save"
+
+	DialogStateEditChoice  DialogState = "edit_choice"
+	DialogStateEditText    DialogState = "edit_text"
+	DialogStateEditTime    DialogState = "edit_time"
+	DialogStateConfirmEdit DialogState = "confirm_edit"
+)
+
+// EditTarget что меняется в заметке при редактировании
+type EditTarget string
+
+const (
+	EditTargetText EditTarget = "text"
+	EditTargetTime EditTarget = "time"
+	EditTargetBoth EditTarget = "both"
+)
+
+// dialogTransitions допустимые переходы между состояниями диалога
+var dialogTransitions = map[DialogState][]DialogState{
+	DialogStateAwaitingText:  {DialogStateConfirmText},
+	DialogStateConfirmText:   {DialogStateAwaitingText, DialogStateAwaitingMonth},
+	DialogStateAwaitingMonth: {DialogStateAwaitingDay, DialogStateConfirmSave},
+	DialogStateAwaitingDay:   {DialogStateAwaitingTime},
+	DialogStateAwaitingTime:  {DialogStateConfirmSave},
+	DialogStateConfirmSave:   {DialogStateAwaitingText},
+
+	DialogStateEditChoice: {DialogStateEditText, DialogStateEditTime},
+	DialogStateEditText:   {DialogStateEditTime, DialogStateConfirmEdit},
+	DialogStateEditTime:   {DialogStateConfirmEdit},
+}
+
+type Dialog struct {
+	ChatID   ChatID
+	State    DialogState
+	Text     string
+	Month    time.Month
+	Day      int
+	NotifyAt time.Time
+	// NoteID и EditTarget заполняются только при редактировании заметки
+	NoteID     NoteID
+	EditTarget EditTarget
+	UpdatedAt  time.Time
+}
+
+// CanTransition проверяет, допустим ли переход диалога в состояние to
+func (d *Dialog) CanTransition(to DialogState) bool {
+	for _, state := range dialogTransitions[d.State] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition переводит диалог в состояние to
+func (d *Dialog) Transition(to DialogState) error {
+	if !d.CanTransition(to) {
+		return ErrInvalidDialogTransition
+	}
+	d.State = to
+	return nil
+}
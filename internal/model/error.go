@@ -3,5 +3,15 @@ package model
 import "errors"
 
 var (
-	ErrNoteNotFound = errors.New("note not found")
+	ErrNoteNotFound            = errors.New("note not found")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrInvalidToken            = errors.New("invalid api token")
+	ErrInvalidTimezone         = errors.New("invalid timezone")
+	ErrDialogNotFound          = errors.New("dialog not found")
+	ErrDialogExpired           = errors.New("dialog expired")
+	ErrInvalidDialogTransition = errors.New("invalid dialog transition")
+	// ErrClaimLost захват напоминания истек и перешел к другому экземпляру notifier
+	ErrClaimLost = errors.New("note claim lost")
+	// ErrNoteNotPending повторение можно изменить только у ожидающей заметки
+	ErrNoteNotPending = errors.New("note is not pending")
 )
@@ -4,16 +4,70 @@ import "time"
 
 type (
 	User struct {
-		ID    UserID
-		Login string
+		ID       UserID
+		Login    string
+		Timezone string
+		// DeliveryState состояние доставки, DeliveryError - текст ошибки telegram, из-за которой доставка приостановлена
+		DeliveryState DeliveryState
+		DeliveryError string
 	}
 
 	Note struct {
-		ID        NoteID
-		UserID    UserID
-		Text      string
-		NotifyAt  time.Time
+		ID       NoteID
+		UserID   UserID
+		Text     string
+		NotifyAt time.Time
+		// Recurrence правило повторения (см. пакет recurrence), пустое для разовых напоминаний
+		Recurrence string
+		Status     NoteStatus
+		// SentAt время последней отправки, Attempts - число попыток отправки текущего напоминания
+		SentAt    *time.Time
+		Attempts  int
 		CreatedAt time.Time
 		DeletedAt *time.Time
+		// AcknowledgedAt время нажатия "Выполнено" в напоминании
+		AcknowledgedAt *time.Time
+	}
+
+	// NoteRef ссылка на заметку пользователя
+	NoteRef struct {
+		ID     NoteID
+		UserID UserID
+	}
+
+	// OutboxMessage сообщение для kafka, записанное в одной транзакции с изменением заметки
+	OutboxMessage struct {
+		ID    int64
+		Key   []byte
+		Value []byte
+		// Headers заголовки сообщения kafka, в них передается контекст трассировки
+		Headers   map[string]string
+		Attempts  int
+		CreatedAt time.Time
+	}
+
+	// NotePatch изменение заметки, nil - поле не меняется, пустое Recurrence отключает повторение
+	NotePatch struct {
+		Text       *string
+		NotifyAt   *time.Time
+		Recurrence *string
+	}
+
+	// NoteFilter отбор и постраничный вывод заметок пользователя, страницы идут по возрастанию id
+	NoteFilter struct {
+		// Status пустой - любой статус
+		Status NoteStatus
+		// Deleted nil - все заметки, true - только удаленные, false - только не удаленные
+		Deleted *bool
+		// AfterID id последней заметки предыдущей страницы
+		AfterID NoteID
+		Limit   int
+	}
+
+	// ClaimStats захваты напоминаний экземплярами notifier
+	ClaimStats struct {
+		Pending int
+		Active  int
+		Expired int
 	}
 )
@@ -0,0 +1,150 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec подмножество cron: "минута час день месяц день_недели".
+// Поддерживаются *, числа, списки через запятую, диапазоны a-b и шаг */n, a/n или a-b/n.
+type cronSpec struct {
+	source   string
+	minutes  []bool
+	hours    []bool
+	days     []bool
+	months   []bool
+	weekdays []bool
+	// anyDay/anyWeekday - поле задано как "*" или "*/N", нужно для семантики "день ИЛИ день недели"
+	anyDay     bool
+	anyWeekday bool
+}
+
+func parseCron(fields []string) (*cronSpec, error) {
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: cron needs 5 fields", ErrInvalidRule)
+	}
+
+	spec := &cronSpec{
+		source:     strings.Join(fields, " "),
+		anyDay:     isCronWildcard(fields[2]),
+		anyWeekday: isCronWildcard(fields[4]),
+	}
+
+	var err error
+	if spec.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if spec.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if spec.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if spec.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if spec.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 7 - тоже воскресенье
+	if spec.weekdays[7] {
+		spec.weekdays[0] = true
+	}
+
+	return spec, nil
+}
+
+// isCronWildcard поле дня начинается с "*": как в стандартном cron, "*/2" тоже не ограничивает другое поле дня
+func isCronWildcard(field string) bool {
+	return strings.HasPrefix(field, "*")
+}
+
+func parseCronField(field string, lo, hi int) ([]bool, error) {
+	allowed := make([]bool, hi+1)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		base, stepStr, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return nil, fmt.Errorf("%w: bad cron step '%s'", ErrInvalidRule, part)
+			}
+			part = base
+		}
+
+		from, to := lo, hi
+		if part != "*" {
+			fromStr, toStr, isRange := strings.Cut(part, "-")
+			var err error
+			if from, err = strconv.Atoi(fromStr); err != nil {
+				return nil, fmt.Errorf("%w: bad cron value '%s'", ErrInvalidRule, part)
+			}
+			// "n/step" означает от n до конца диапазона с шагом step
+			if !hasStep {
+				to = from
+			}
+			if isRange {
+				if to, err = strconv.Atoi(toStr); err != nil {
+					return nil, fmt.Errorf("%w: bad cron range '%s'", ErrInvalidRule, part)
+				}
+			}
+		}
+
+		if from < lo || to > hi || from > to {
+			return nil, fmt.Errorf("%w: cron value '%s' out of range %d-%d", ErrInvalidRule, field, lo, hi)
+		}
+
+		for value := from; value <= to; value += step {
+			allowed[value] = true
+		}
+	}
+
+	return allowed, nil
+}
+
+func (s *cronSpec) next(after time.Time) time.Time {
+	loc := after.Location()
+	start := after.Truncate(time.Minute).Add(time.Minute)
+
+	for days := 0; days < cronSearchDays; days++ {
+		day := time.Date(start.Year(), start.Month(), start.Day()+days, 0, 0, 0, 0, loc)
+		if !s.matchDay(day) {
+			continue
+		}
+
+		for hour := 0; hour < 24; hour++ {
+			if !s.hours[hour] {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if !s.minutes[minute] {
+					continue
+				}
+				candidate := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+				if !candidate.Before(start) {
+					return candidate
+				}
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSpec) matchDay(day time.Time) bool {
+	if !s.months[day.Month()] {
+		return false
+	}
+
+	dayMatch := s.days[day.Day()]
+	weekdayMatch := s.weekdays[day.Weekday()]
+
+	// Если одно из полей начинается с "*", дни отбираются по обоим полям, иначе достаточно одного
+	if s.anyDay || s.anyWeekday {
+		return dayMatch && weekdayMatch
+	}
+	return dayMatch || weekdayMatch
+}
@@ -0,0 +1,102 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field  string
+		lo, hi int
+		want   []int
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1,5,7", 0, 10, []int{1, 5, 7}},
+		{"2-4", 0, 10, []int{2, 3, 4}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"5/15", 0, 59, []int{5, 20, 35, 50}},
+		{"10-20/5", 0, 59, []int{10, 15, 20}},
+		{"20/2", 0, 23, []int{20, 22}},
+		{"1-3,10/10", 1, 31, []int{1, 2, 3, 10, 20, 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			allowed, err := parseCronField(tt.field, tt.lo, tt.hi)
+			if err != nil {
+				t.Fatalf("parseCronField(%q): %v", tt.field, err)
+			}
+
+			var got []int
+			for value, ok := range allowed {
+				if ok {
+					got = append(got, value)
+				}
+			}
+			if !equalInts(got, tt.want) {
+				t.Errorf("parseCronField(%q) = %v, want %v", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronFieldRejects(t *testing.T) {
+	for _, field := range []string{"", "60", "-1", "5-2", "*/0", "*/x", "a", "1-", "10/", "0-60/5"} {
+		if _, err := parseCronField(field, 0, 59); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("parseCronField(%q) error = %v, want ErrInvalidRule", field, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	// среда, 15 мая 2024 года, 10:30
+	after := time.Date(2024, time.May, 15, 10, 30, 0, 0, loc)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.May, 15, 10, 31, 0, 0, loc)},
+		{"30 10 * * *", time.Date(2024, time.May, 16, 10, 30, 0, 0, loc)},
+		{"5/20 * * * *", time.Date(2024, time.May, 15, 10, 45, 0, 0, loc)},
+		{"0 9 * * 1-5", time.Date(2024, time.May, 16, 9, 0, 0, 0, loc)},
+		{"0 9 * * 0", time.Date(2024, time.May, 19, 9, 0, 0, 0, loc)},
+		{"0 9 * * 7", time.Date(2024, time.May, 19, 9, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2024, time.June, 1, 0, 0, 0, 0, loc)},
+		{"0 12 29 2 *", time.Date(2028, time.February, 29, 12, 0, 0, 0, loc)},
+		// день месяца ИЛИ день недели: 20 число или ближайшая пятница
+		{"0 8 20 * 5", time.Date(2024, time.May, 17, 8, 0, 0, 0, loc)},
+		{"0 8 16 * 5", time.Date(2024, time.May, 16, 8, 0, 0, 0, loc)},
+		// шаг от "*" отбирает по обоим полям: нечетное число И понедельник, а не нечетное ИЛИ понедельник
+		{"0 9 */2 * 1", time.Date(2024, time.May, 27, 9, 0, 0, 0, loc)},
+		{"0 9 13 * */2", time.Date(2024, time.June, 13, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule, err := Parse("cron " + tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := rule.Next(after); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", after, got, tt.want)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
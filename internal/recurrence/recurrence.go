@@ -0,0 +1,282 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindInterval Kind = "every"
+	KindDaily    Kind = "daily"
+	KindWeekly   Kind = "weekly"
+	KindMonthly  Kind = "monthly"
+	KindCron     Kind = "cron"
+
+	minInterval = time.Minute
+	// maxInterval верхняя граница интервала, защищает от переполнения time.Duration
+	maxInterval = 3660 * 24 * time.Hour
+	// cronSearchDays горизонт поиска следующего срабатывания cron-выражения
+	cronSearchDays = 366 * 5
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var kindAliases = map[string]Kind{
+	"every": KindInterval, "каждые": KindInterval, "каждый": KindInterval, "каждую": KindInterval,
+	"daily": KindDaily, "ежедневно": KindDaily,
+	"weekly": KindWeekly, "еженедельно": KindWeekly,
+	"monthly": KindMonthly, "ежемесячно": KindMonthly,
+	"cron": KindCron,
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "вс": time.Sunday,
+	"mon": time.Monday, "пн": time.Monday,
+	"tue": time.Tuesday, "вт": time.Tuesday,
+	"wed": time.Wednesday, "ср": time.Wednesday,
+	"thu": time.Thursday, "чт": time.Thursday,
+	"fri": time.Friday, "пт": time.Friday,
+	"sat": time.Saturday, "сб": time.Saturday,
+}
+
+var weekdayShort = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Rule правило повторения напоминания.
+// Строковая форма (хранится в БД):
+//
+//	every 30m | every 2h | every 3d
+//	daily 09:00
+//	weekly mon,thu 09:00
+//	monthly 15 09:00
+//	cron 0 9 * * 1-5
+type Rule struct {
+	Kind       Kind
+	Interval   time.Duration
+	Weekdays   []time.Weekday
+	DayOfMonth int
+	Hour       int
+	Minute     int
+	cron       *cronSpec
+}
+
+// Parse разбирает правило повторения, принимает английские и русские ключевые слова
+func Parse(input string) (Rule, error) {
+	fields := strings.Fields(strings.ToLower(input))
+	if len(fields) < 2 {
+		return Rule{}, ErrInvalidRule
+	}
+
+	kind, ok := kindAliases[fields[0]]
+	if !ok {
+		return Rule{}, fmt.Errorf("%w: unknown kind '%s'", ErrInvalidRule, fields[0])
+	}
+
+	rule := Rule{Kind: kind}
+	args := fields[1:]
+
+	var err error
+	switch kind {
+	case KindInterval:
+		if len(args) != 1 {
+			return Rule{}, ErrInvalidRule
+		}
+		if rule.Interval, err = parseInterval(args[0]); err != nil {
+			return Rule{}, err
+		}
+	case KindDaily:
+		if len(args) != 1 {
+			return Rule{}, ErrInvalidRule
+		}
+		if rule.Hour, rule.Minute, err = parseClock(args[0]); err != nil {
+			return Rule{}, err
+		}
+	case KindWeekly:
+		if len(args) != 2 {
+			return Rule{}, ErrInvalidRule
+		}
+		if rule.Weekdays, err = parseWeekdays(args[0]); err != nil {
+			return Rule{}, err
+		}
+		if rule.Hour, rule.Minute, err = parseClock(args[1]); err != nil {
+			return Rule{}, err
+		}
+	case KindMonthly:
+		if len(args) != 2 {
+			return Rule{}, ErrInvalidRule
+		}
+		rule.DayOfMonth, err = strconv.Atoi(args[0])
+		if err != nil || rule.DayOfMonth < 1 || rule.DayOfMonth > 31 {
+			return Rule{}, fmt.Errorf("%w: bad day of month '%s'", ErrInvalidRule, args[0])
+		}
+		if rule.Hour, rule.Minute, err = parseClock(args[1]); err != nil {
+			return Rule{}, err
+		}
+	case KindCron:
+		if rule.cron, err = parseCron(args); err != nil {
+			return Rule{}, err
+		}
+	}
+
+	return rule, nil
+}
+
+// String возвращает каноническую строковую форму правила
+func (r Rule) String() string {
+	switch r.Kind {
+	case KindInterval:
+		return fmt.Sprintf("every %s", formatInterval(r.Interval))
+	case KindDaily:
+		return fmt.Sprintf("daily %02d:%02d", r.Hour, r.Minute)
+	case KindWeekly:
+		names := make([]string, 0, len(r.Weekdays))
+		for _, weekday := range r.Weekdays {
+			names = append(names, weekdayShort[weekday])
+		}
+		return fmt.Sprintf("weekly %s %02d:%02d", strings.Join(names, ","), r.Hour, r.Minute)
+	case KindMonthly:
+		return fmt.Sprintf("monthly %d %02d:%02d", r.DayOfMonth, r.Hour, r.Minute)
+	case KindCron:
+		return "cron " + r.cron.source
+	}
+	return ""
+}
+
+// Next возвращает первое срабатывание строго после after в часовом поясе after.
+// Для интервального правила отсчет ведется от after.
+func (r Rule) Next(after time.Time) time.Time {
+	loc := after.Location()
+
+	switch r.Kind {
+	case KindInterval:
+		return after.Add(r.Interval)
+	case KindDaily:
+		next := time.Date(after.Year(), after.Month(), after.Day(), r.Hour, r.Minute, 0, 0, loc)
+		if !next.After(after) {
+			next = time.Date(after.Year(), after.Month(), after.Day()+1, r.Hour, r.Minute, 0, 0, loc)
+		}
+		return next
+	case KindWeekly:
+		for days := 0; days <= 7; days++ {
+			next := time.Date(after.Year(), after.Month(), after.Day()+days, r.Hour, r.Minute, 0, 0, loc)
+			if next.After(after) && r.hasWeekday(next.Weekday()) {
+				return next
+			}
+		}
+	case KindMonthly:
+		for months := 0; months <= 12; months++ {
+			first := time.Date(after.Year(), after.Month()+time.Month(months), 1, 0, 0, 0, 0, loc)
+			day := min(r.DayOfMonth, daysIn(first.Month(), first.Year()))
+			next := time.Date(first.Year(), first.Month(), day, r.Hour, r.Minute, 0, 0, loc)
+			if next.After(after) {
+				return next
+			}
+		}
+	case KindCron:
+		return r.cron.next(after)
+	}
+
+	return time.Time{}
+}
+
+// NextAfterNow возвращает ближайшее срабатывание после now, начиная отсчет от prev.
+// Пропущенные срабатывания (например, пока сервис был недоступен) не повторяются.
+func (r Rule) NextAfterNow(prev, now time.Time) time.Time {
+	next := r.Next(prev)
+	if next.IsZero() || next.After(now) {
+		return next
+	}
+
+	if r.Kind == KindInterval {
+		skipped := now.Sub(next)/r.Interval + 1
+		return next.Add(skipped * r.Interval)
+	}
+
+	return r.Next(now)
+}
+
+func (r Rule) hasWeekday(weekday time.Weekday) bool {
+	for _, w := range r.Weekdays {
+		if w == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func parseInterval(input string) (time.Duration, error) {
+	input = strings.NewReplacer("ч", "h", "мин", "m", "м", "m").Replace(input)
+
+	var interval time.Duration
+	if strings.HasSuffix(input, "d") || strings.HasSuffix(input, "д") {
+		days, err := strconv.ParseInt(strings.TrimRight(input, "dд"), 10, 64)
+		if err != nil || days > int64(maxInterval/(24*time.Hour)) {
+			return 0, fmt.Errorf("%w: bad interval '%s'", ErrInvalidRule, input)
+		}
+		interval = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		if interval, err = time.ParseDuration(input); err != nil {
+			return 0, fmt.Errorf("%w: bad interval '%s'", ErrInvalidRule, input)
+		}
+	}
+
+	if interval < minInterval || interval%time.Minute != 0 {
+		return 0, fmt.Errorf("%w: interval must be a whole number of minutes, at least %s", ErrInvalidRule, minInterval)
+	}
+	if interval > maxInterval {
+		return 0, fmt.Errorf("%w: interval must be at most %s", ErrInvalidRule, formatInterval(maxInterval))
+	}
+
+	return interval, nil
+}
+
+func formatInterval(interval time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case interval%day == 0:
+		return fmt.Sprintf("%dd", interval/day)
+	case interval%time.Hour == 0:
+		return fmt.Sprintf("%dh", interval/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", interval/time.Minute)
+	}
+}
+
+func parseClock(input string) (int, int, error) {
+	clock, err := time.Parse("15:04", input)
+	if err != nil {
+		if clock, err = time.Parse("15", input); err != nil {
+			return 0, 0, fmt.Errorf("%w: bad time '%s'", ErrInvalidRule, input)
+		}
+	}
+	return clock.Hour(), clock.Minute(), nil
+}
+
+func parseWeekdays(input string) ([]time.Weekday, error) {
+	seen := make(map[time.Weekday]bool)
+	for _, name := range strings.Split(input, ",") {
+		weekday, ok := weekdayNames[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: bad weekday '%s'", ErrInvalidRule, name)
+		}
+		seen[weekday] = true
+	}
+
+	weekdays := make([]time.Weekday, 0, len(seen))
+	for weekday := range seen {
+		weekdays = append(weekdays, weekday)
+	}
+	sort.Slice(weekdays, func(i, j int) bool { return weekdays[i] < weekdays[j] })
+
+	return weekdays, nil
+}
+
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
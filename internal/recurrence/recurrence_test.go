@@ -0,0 +1,114 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"every 30m", "every 30m"},
+		{"каждые 2ч", "every 2h"},
+		{"every 90m", "every 90m"},
+		{"every 3d", "every 3d"},
+		{"every 3660d", "every 3660d"},
+		{"ежедневно 9", "daily 09:00"},
+		{"weekly thu,mon,thu 09:30", "weekly mon,thu 09:30"},
+		{"еженедельно пн,пт 18:00", "weekly mon,fri 18:00"},
+		{"monthly 31 08:00", "monthly 31 08:00"},
+		{"CRON 0 9 * * 1-5", "cron 0 9 * * 1-5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rule, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("Parse(%q).String() = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	inputs := []string{
+		"", "every", "yearly 1", "every 30s", "every 0m", "every 1h30s",
+		"every 3661d", "every 200000d", "every 9999999999999999999d", "every 100000h",
+		"daily 25:00", "weekly xyz 09:00", "weekly mon", "monthly 32 09:00",
+		"monthly 0 09:00", "cron 0 9 * *", "cron 60 * * * *",
+	}
+	for _, input := range inputs {
+		if _, err := Parse(input); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalidRule", input, err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	// среда, 15 мая 2024 года, 10:30
+	after := time.Date(2024, time.May, 15, 10, 30, 0, 0, loc)
+
+	tests := []struct {
+		rule  string
+		after time.Time
+		want  time.Time
+	}{
+		{"every 45m", after, after.Add(45 * time.Minute)},
+		{"daily 11:00", after, time.Date(2024, time.May, 15, 11, 0, 0, 0, loc)},
+		{"daily 10:30", after, time.Date(2024, time.May, 16, 10, 30, 0, 0, loc)},
+		{"weekly wed 10:30", after, time.Date(2024, time.May, 22, 10, 30, 0, 0, loc)},
+		{"weekly mon,fri 09:00", after, time.Date(2024, time.May, 17, 9, 0, 0, 0, loc)},
+		{"monthly 15 12:00", after, time.Date(2024, time.May, 15, 12, 0, 0, 0, loc)},
+		{"monthly 10 12:00", after, time.Date(2024, time.June, 10, 12, 0, 0, 0, loc)},
+		// 31 число в коротком месяце сдвигается на последний день
+		{"monthly 31 09:00", time.Date(2024, time.June, 1, 0, 0, 0, 0, loc), time.Date(2024, time.June, 30, 9, 0, 0, 0, loc)},
+		{"monthly 31 09:00", time.Date(2024, time.February, 1, 0, 0, 0, 0, loc), time.Date(2024, time.February, 29, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			if got := rule.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextAfterNowSkipsMissed(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	prev := time.Date(2024, time.May, 10, 9, 0, 0, 0, loc)
+	now := time.Date(2024, time.May, 15, 10, 30, 0, 0, loc)
+
+	tests := []struct {
+		rule string
+		want time.Time
+	}{
+		{"every 2h", time.Date(2024, time.May, 15, 11, 0, 0, 0, loc)},
+		{"daily 09:00", time.Date(2024, time.May, 16, 9, 0, 0, 0, loc)},
+		{"weekly fri 09:00", time.Date(2024, time.May, 17, 9, 0, 0, 0, loc)},
+		{"cron */20 * * * *", time.Date(2024, time.May, 15, 10, 40, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			if got := rule.NextAfterNow(prev, now); !got.Equal(tt.want) {
+				t.Errorf("NextAfterNow(%s, %s) = %s, want %s", prev, now, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package dialog
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/model"
+	"time"
+)
+
+type (
+	Repository interface {
+		GetDialog(ctx context.Context, chatID model.ChatID) (*model.Dialog, error)
+		SaveDialog(ctx context.Context, dialog model.Dialog) error
+		DeleteDialog(ctx context.Context, chatID model.ChatID) error
+		// DeleteExpiredDialogs удаляет диалоги, не изменявшиеся с before, возвращает число удаленных
+		DeleteExpiredDialogs(ctx context.Context, before time.Time) (int64, error)
+	}
+)
@@ -0,0 +1,51 @@
+package dialog
+
+import (
+	"context"
+	"errors"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/internal/model"
+	"time"
+)
+
+// InstrumentedRepository пишет метрики длительности и ошибок каждого метода репозитория
+type InstrumentedRepository struct {
+	repo Repository
+}
+
+func NewInstrumentedRepository(repo Repository) *InstrumentedRepository {
+	return &InstrumentedRepository{repo: repo}
+}
+
+// observe учитывает запрос, отсутствие записи ошибкой не считается
+func observe(method string, start time.Time, err error) {
+	metrics.ObserveQuery("dialog", method, start, err != nil && !errors.Is(err, model.ErrDialogNotFound))
+}
+
+func (r *InstrumentedRepository) GetDialog(ctx context.Context, chatID model.ChatID) (*model.Dialog, error) {
+	start := time.Now()
+	result, err := r.repo.GetDialog(ctx, chatID)
+	observe("GetDialog", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) SaveDialog(ctx context.Context, dialog model.Dialog) error {
+	start := time.Now()
+	err := r.repo.SaveDialog(ctx, dialog)
+	observe("SaveDialog", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) DeleteDialog(ctx context.Context, chatID model.ChatID) error {
+	start := time.Now()
+	err := r.repo.DeleteDialog(ctx, chatID)
+	observe("DeleteDialog", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) DeleteExpiredDialogs(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	result, err := r.repo.DeleteExpiredDialogs(ctx, before)
+	observe("DeleteExpiredDialogs", start, err)
+	return result, err
+}
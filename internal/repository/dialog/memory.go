@@ -0,0 +1,59 @@
+package dialog
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/model"
+	"sync"
+	"time"
+)
+
+// MemoryRepository хранит состояние диалогов в памяти процесса, теряется при перезапуске
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	dialogs map[model.ChatID]model.Dialog
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{dialogs: make(map[model.ChatID]model.Dialog)}
+}
+
+func (m *MemoryRepository) GetDialog(_ context.Context, chatID model.ChatID) (*model.Dialog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dialog, ok := m.dialogs[chatID]
+	if !ok {
+		return nil, model.ErrDialogNotFound
+	}
+	return &dialog, nil
+}
+
+func (m *MemoryRepository) SaveDialog(_ context.Context, dialog model.Dialog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dialogs[dialog.ChatID] = dialog
+	return nil
+}
+
+func (m *MemoryRepository) DeleteDialog(_ context.Context, chatID model.ChatID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.dialogs, chatID)
+	return nil
+}
+
+func (m *MemoryRepository) DeleteExpiredDialogs(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for chatID, dialog := range m.dialogs {
+		if dialog.UpdatedAt.Before(before) {
+			delete(m.dialogs, chatID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
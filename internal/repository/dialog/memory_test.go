@@ -0,0 +1,43 @@
+package dialog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kotche/bot/internal/model"
+)
+
+func TestMemoryRepositoryDeleteExpiredDialogs(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	now := time.Now()
+
+	for chatID, updatedAt := range map[model.ChatID]time.Time{
+		1: now.Add(-time.Hour),
+		2: now.Add(-time.Minute),
+		3: now,
+	} {
+		if err := repo.SaveDialog(ctx, model.Dialog{ChatID: chatID, UpdatedAt: updatedAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := repo.DeleteExpiredDialogs(ctx, now.Add(-30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Fatalf("deleted = %d, want 2", deleted)
+	}
+
+	for _, chatID := range []model.ChatID{1, 2} {
+		if _, err = repo.GetDialog(ctx, chatID); !errors.Is(err, model.ErrDialogNotFound) {
+			t.Errorf("dialog %d: err = %v, want ErrDialogNotFound", chatID, err)
+		}
+	}
+	if _, err = repo.GetDialog(ctx, 3); err != nil {
+		t.Errorf("dialog 3: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package dialog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/model"
+	_ "github.com/lib/pq"
+	"time"
+)
+
+type DefaultRepository struct {
+	db *sql.DB
+}
+
+func NewDefaultRepository(pg *sql.DB) *DefaultRepository {
+	return &DefaultRepository{pg}
+}
+
+func (d *DefaultRepository) GetDialog(ctx context.Context, chatID model.ChatID) (*model.Dialog, error) {
+	ctx, span := tracing.StartSpan(ctx, "GetDialog_repo")
+	defer span.End()
+
+	var (
+		dialog   = &model.Dialog{}
+		month    int
+		notifyAt sql.NullTime
+	)
+	query := `SELECT chat_id, state, text, month, day, notify_at, note_id, edit_target, updated_at FROM dialogs WHERE chat_id = $1`
+	err := d.db.QueryRowContext(ctx, query, chatID).Scan(&dialog.ChatID, &dialog.State, &dialog.Text, &month,
+		&dialog.Day, &notifyAt, &dialog.NoteID, &dialog.EditTarget, &dialog.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.ErrDialogNotFound
+		}
+		return nil, fmt.Errorf("failed to get dialog for chat '%d': %w", chatID, err)
+	}
+
+	dialog.Month = time.Month(month)
+	if notifyAt.Valid {
+		dialog.NotifyAt = notifyAt.Time
+	}
+
+	return dialog, nil
+}
+
+func (d *DefaultRepository) SaveDialog(ctx context.Context, dialog model.Dialog) error {
+	ctx, span := tracing.StartSpan(ctx, "SaveDialog_repo")
+	defer span.End()
+
+	query := `
+		INSERT INTO dialogs (chat_id, state, text, month, day, notify_at, note_id, edit_target, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			state = EXCLUDED.state,
+			text = EXCLUDED.text,
+			month = EXCLUDED.month,
+			day = EXCLUDED.day,
+			notify_at = EXCLUDED.notify_at,
+			note_id = EXCLUDED.note_id,
+			edit_target = EXCLUDED.edit_target,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	var notifyAt sql.NullTime
+	if !dialog.NotifyAt.IsZero() {
+		notifyAt = sql.NullTime{Time: dialog.NotifyAt, Valid: true}
+	}
+
+	if _, err := d.db.ExecContext(ctx, query, dialog.ChatID, dialog.State, dialog.Text,
+		int(dialog.Month), dialog.Day, notifyAt, dialog.NoteID, dialog.EditTarget, dialog.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save dialog for chat '%d': %w", dialog.ChatID, err)
+	}
+
+	return nil
+}
+
+func (d *DefaultRepository) DeleteDialog(ctx context.Context, chatID model.ChatID) error {
+	ctx, span := tracing.StartSpan(ctx, "DeleteDialog_repo")
+	defer span.End()
+
+	query := `DELETE FROM dialogs WHERE chat_id = $1`
+	if _, err := d.db.ExecContext(ctx, query, chatID); err != nil {
+		return fmt.Errorf("failed to delete dialog for chat '%d': %w", chatID, err)
+	}
+	return nil
+}
+
+func (d *DefaultRepository) DeleteExpiredDialogs(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracing.StartSpan(ctx, "DeleteExpiredDialogs_repo")
+	defer span.End()
+
+	query := `DELETE FROM dialogs WHERE updated_at < $1`
+	res, err := d.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired dialogs: %w", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return deleted, nil
+}
@@ -7,14 +7,30 @@ import (
 )
 
 type (
+	// Repository изменения заметок пишут событие в outbox в той же транзакции, событие публикует relay notifier
 	Repository interface {
 		UserExists(ctx context.Context, userID model.UserID) (bool, error)
 		CreateUser(ctx context.Context, user model.User) error
-		CreateNote(ctx context.Context, note model.Note) (model.NoteID, error)
+		GetUser(ctx context.Context, userID model.UserID) (*model.User, error)
+		SetUserTimezone(ctx context.Context, userID model.UserID, timezone string) error
+		SetDeliveryState(ctx context.Context, userID model.UserID, state model.DeliveryState, reason string) (bool, error)
+		CreateNote(ctx context.Context, note model.Note, message func(model.NoteID) (model.OutboxMessage, error)) (model.NoteID, error)
 		NoteExists(ctx context.Context, noteID model.NoteID, userID model.UserID) (bool, error)
 		GetNote(ctx context.Context, noteID model.NoteID, userID model.UserID) (*model.Note, error)
-		DeleteNote(ctx context.Context, noteID model.NoteID, userID model.UserID) error
+		UpdateNote(ctx context.Context, note model.Note, message model.OutboxMessage) error
+		DeleteNote(ctx context.Context, noteID model.NoteID, userID model.UserID, message model.OutboxMessage) error
+		SetRecurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, recurrence string, message model.OutboxMessage) error
+		// PatchNote меняет переданные поля заметки одним запросом, сообщения пишутся в outbox в той же транзакции
+		PatchNote(ctx context.Context, noteID model.NoteID, userID model.UserID, patch model.NotePatch, messages []model.OutboxMessage) error
+		SkipOccurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, notifyAt time.Time, message model.OutboxMessage) error
+		SnoozeNote(ctx context.Context, noteID model.NoteID, userID model.UserID, notifyAt time.Time, message model.OutboxMessage) error
+		AcknowledgeNote(ctx context.Context, noteID model.NoteID, userID model.UserID, message model.OutboxMessage) error
+		MarkSent(ctx context.Context, refs []model.NoteRef) (int64, error)
+		CompleteDelivery(ctx context.Context, note model.Note, owner string, nextNotifyAt *time.Time, message model.OutboxMessage) error
+		MarkFailed(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, message model.OutboxMessage) error
 		ListNotes(ctx context.Context, userID model.UserID, showDeleted bool) ([]model.Note, error)
-		ReceiveNotifications(ctx context.Context, startTime, endTime time.Time) ([]model.Note, error)
+		ListNotesPage(ctx context.Context, userID model.UserID, filter model.NoteFilter) ([]model.Note, error)
+		ClaimNotifications(ctx context.Context, owner string, dueBefore time.Time, lease time.Duration, limit int) ([]model.Note, int, error)
+		ClaimStats(ctx context.Context) (model.ClaimStats, error)
 	}
 )
@@ -0,0 +1,178 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/internal/model"
+	"time"
+)
+
+// InstrumentedRepository пишет метрики длительности и ошибок каждого метода репозитория
+type InstrumentedRepository struct {
+	repo Repository
+}
+
+func NewInstrumentedRepository(repo Repository) *InstrumentedRepository {
+	return &InstrumentedRepository{repo: repo}
+}
+
+// observe учитывает запрос, отсутствие записи, потерянный захват и неподходящий статус ошибкой не считаются
+func observe(method string, start time.Time, err error) {
+	metrics.ObserveQuery("notes", method, start, err != nil && !errors.Is(err, model.ErrNoteNotFound) &&
+		!errors.Is(err, model.ErrUserNotFound) && !errors.Is(err, model.ErrClaimLost) && !errors.Is(err, model.ErrNoteNotPending))
+}
+
+func (r *InstrumentedRepository) UserExists(ctx context.Context, userID model.UserID) (bool, error) {
+	start := time.Now()
+	result, err := r.repo.UserExists(ctx, userID)
+	observe("UserExists", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) CreateUser(ctx context.Context, user model.User) error {
+	start := time.Now()
+	err := r.repo.CreateUser(ctx, user)
+	observe("CreateUser", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) GetUser(ctx context.Context, userID model.UserID) (*model.User, error) {
+	start := time.Now()
+	result, err := r.repo.GetUser(ctx, userID)
+	observe("GetUser", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) SetUserTimezone(ctx context.Context, userID model.UserID, timezone string) error {
+	start := time.Now()
+	err := r.repo.SetUserTimezone(ctx, userID, timezone)
+	observe("SetUserTimezone", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) SetDeliveryState(ctx context.Context, userID model.UserID, state model.DeliveryState, reason string) (bool, error) {
+	start := time.Now()
+	result, err := r.repo.SetDeliveryState(ctx, userID, state, reason)
+	observe("SetDeliveryState", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) CreateNote(ctx context.Context, note model.Note, message func(model.NoteID) (model.OutboxMessage, error)) (model.NoteID, error) {
+	start := time.Now()
+	result, err := r.repo.CreateNote(ctx, note, message)
+	observe("CreateNote", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) NoteExists(ctx context.Context, noteID model.NoteID, userID model.UserID) (bool, error) {
+	start := time.Now()
+	result, err := r.repo.NoteExists(ctx, noteID, userID)
+	observe("NoteExists", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) GetNote(ctx context.Context, noteID model.NoteID, userID model.UserID) (*model.Note, error) {
+	start := time.Now()
+	result, err := r.repo.GetNote(ctx, noteID, userID)
+	observe("GetNote", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) UpdateNote(ctx context.Context, note model.Note, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.UpdateNote(ctx, note, message)
+	observe("UpdateNote", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) DeleteNote(ctx context.Context, noteID model.NoteID, userID model.UserID, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.DeleteNote(ctx, noteID, userID, message)
+	observe("DeleteNote", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) SetRecurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, recurrence string, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.SetRecurrence(ctx, noteID, userID, recurrence, message)
+	observe("SetRecurrence", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) PatchNote(ctx context.Context, noteID model.NoteID, userID model.UserID, patch model.NotePatch, messages []model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.PatchNote(ctx, noteID, userID, patch, messages)
+	observe("PatchNote", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) SkipOccurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, notifyAt time.Time, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.SkipOccurrence(ctx, noteID, userID, owner, notifyAt, message)
+	observe("SkipOccurrence", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) SnoozeNote(ctx context.Context, noteID model.NoteID, userID model.UserID, notifyAt time.Time, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.SnoozeNote(ctx, noteID, userID, notifyAt, message)
+	observe("SnoozeNote", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) AcknowledgeNote(ctx context.Context, noteID model.NoteID, userID model.UserID, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.AcknowledgeNote(ctx, noteID, userID, message)
+	observe("AcknowledgeNote", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) MarkSent(ctx context.Context, refs []model.NoteRef) (int64, error) {
+	start := time.Now()
+	result, err := r.repo.MarkSent(ctx, refs)
+	observe("MarkSent", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) CompleteDelivery(ctx context.Context, note model.Note, owner string, nextNotifyAt *time.Time, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.CompleteDelivery(ctx, note, owner, nextNotifyAt, message)
+	observe("CompleteDelivery", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) MarkFailed(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, message model.OutboxMessage) error {
+	start := time.Now()
+	err := r.repo.MarkFailed(ctx, noteID, userID, owner, message)
+	observe("MarkFailed", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) ListNotes(ctx context.Context, userID model.UserID, showDeleted bool) ([]model.Note, error) {
+	start := time.Now()
+	result, err := r.repo.ListNotes(ctx, userID, showDeleted)
+	observe("ListNotes", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) ListNotesPage(ctx context.Context, userID model.UserID, filter model.NoteFilter) ([]model.Note, error) {
+	start := time.Now()
+	result, err := r.repo.ListNotesPage(ctx, userID, filter)
+	observe("ListNotesPage", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) ClaimNotifications(ctx context.Context, owner string, dueBefore time.Time, lease time.Duration, limit int) ([]model.Note, int, error) {
+	start := time.Now()
+	result, count, err := r.repo.ClaimNotifications(ctx, owner, dueBefore, lease, limit)
+	observe("ClaimNotifications", start, err)
+	return result, count, err
+}
+
+func (r *InstrumentedRepository) ClaimStats(ctx context.Context) (model.ClaimStats, error) {
+	start := time.Now()
+	result, err := r.repo.ClaimStats(ctx)
+	observe("ClaimStats", start, err)
+	return result, err
+}
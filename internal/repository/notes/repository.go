@@ -3,11 +3,12 @@ package notes
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/kotche/bot/infrastructure/tracing"
 	"github.com/kotche/bot/internal/model"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"time"
 
 	"github.com/Masterminds/squirrel"
@@ -22,6 +23,9 @@ func NewDefaultRepository(pg *sql.DB) *DefaultRepository {
 }
 
 func (d *DefaultRepository) UserExists(ctx context.Context, userID model.UserID) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "UserExists_repo")
+	defer span.End()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`
 	err := d.db.QueryRowContext(ctx, query, userID).Scan(&exists)
@@ -32,30 +36,116 @@ func (d *DefaultRepository) UserExists(ctx context.Context, userID model.UserID)
 }
 
 func (d *DefaultRepository) CreateUser(ctx context.Context, user model.User) error {
-	query := `INSERT INTO users (id, login, created_at) VALUES ($1, $2, NOW())`
-	if _, err := d.db.ExecContext(ctx, query, user.ID, user.Login); err != nil {
+	ctx, span := tracing.StartSpan(ctx, "CreateUser_repo")
+	defer span.End()
+
+	query := `INSERT INTO users (id, login, timezone, created_at) VALUES ($1, $2, $3, NOW())`
+	if _, err := d.db.ExecContext(ctx, query, user.ID, user.Login, user.Timezone); err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 	return nil
 }
 
-func (d *DefaultRepository) CreateNote(ctx context.Context, note model.Note) (model.NoteID, error) {
+func (d *DefaultRepository) GetUser(ctx context.Context, userID model.UserID) (*model.User, error) {
+	ctx, span := tracing.StartSpan(ctx, "GetUser_repo")
+	defer span.End()
+
+	user := &model.User{}
+	var deliveryError sql.NullString
+	query := `SELECT id, login, timezone, delivery_state, delivery_error FROM users WHERE id = $1 AND deleted_at IS NULL`
+	err := d.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Login, &user.Timezone, &user.DeliveryState, &deliveryError)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user '%d': %w", userID, err)
+	}
+	user.DeliveryError = deliveryError.String
+	return user, nil
+}
+
+func (d *DefaultRepository) SetUserTimezone(ctx context.Context, userID model.UserID, timezone string) error {
+	ctx, span := tracing.StartSpan(ctx, "SetUserTimezone_repo")
+	defer span.End()
+
+	query := `UPDATE users SET timezone = $1 WHERE id = $2 AND deleted_at IS NULL`
+	res, err := d.db.ExecContext(ctx, query, timezone, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set timezone for user '%d': %w", userID, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return model.ErrUserNotFound
+	}
+	return nil
+}
+
+// SetDeliveryState меняет состояние доставки пользователя, возвращает false, если состояние уже было таким
+func (d *DefaultRepository) SetDeliveryState(ctx context.Context, userID model.UserID, state model.DeliveryState, reason string) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "SetDeliveryState_repo")
+	defer span.End()
+
+	query := `
+		UPDATE users SET delivery_state = $1, delivery_error = NULLIF($2, ''), delivery_state_at = NOW()
+		WHERE id = $3 AND deleted_at IS NULL AND delivery_state <> $1
+	`
+	res, err := d.db.ExecContext(ctx, query, state, reason, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set delivery state for user '%d': %w", userID, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// CreateNote создает заметку и в той же транзакции пишет в outbox сообщение, построенное по id новой заметки
+func (d *DefaultRepository) CreateNote(ctx context.Context, note model.Note, message func(model.NoteID) (model.OutboxMessage, error)) (model.NoteID, error) {
+	ctx, span := tracing.StartSpan(ctx, "CreateNote_repo")
+	defer span.End()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin note transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO notes (user_id, text, notify_at, created_at)
-		VALUES ($1, $2, $3, NOW())
+		INSERT INTO notes (user_id, text, notify_at, recurrence, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
 		RETURNING id
 	`
 
 	var noteID model.NoteID
-	err := d.db.QueryRowContext(ctx, query, note.UserID, note.Text, note.NotifyAt).Scan(&noteID)
+	err = tx.QueryRowContext(ctx, query, note.UserID, note.Text, note.NotifyAt, note.Recurrence).Scan(&noteID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create note: %w", err)
 	}
 
+	outboxMessage, err := message(noteID)
+	if err != nil {
+		return 0, err
+	}
+	if err = insertOutbox(ctx, tx, outboxMessage); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit note %d: %w", noteID, err)
+	}
 	return noteID, nil
 }
 
 func (d *DefaultRepository) NoteExists(ctx context.Context, noteID model.NoteID, userID model.UserID) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "NoteExists_repo")
+	defer span.End()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM notes WHERE id = $1 AND user_id = $2)`
 	err := d.db.QueryRowContext(ctx, query, noteID, userID).Scan(&exists)
@@ -66,9 +156,16 @@ func (d *DefaultRepository) NoteExists(ctx context.Context, noteID model.NoteID,
 }
 
 func (d *DefaultRepository) GetNote(ctx context.Context, noteID model.NoteID, userID model.UserID) (*model.Note, error) {
+	ctx, span := tracing.StartSpan(ctx, "GetNote_repo")
+	defer span.End()
+
 	note := &model.Note{}
-	query := `SELECT id, user_id, text, notify_at, created_at, deleted_at FROM notes WHERE id = $1 AND user_id = $2`
-	err := d.db.QueryRowContext(ctx, query, noteID, userID).Scan(&note.ID, &note.UserID, &note.Text, &note.NotifyAt, &note.CreatedAt, &note.DeletedAt)
+	query := `
+		SELECT id, user_id, text, notify_at, recurrence, status, sent_at, attempts, created_at, deleted_at, acknowledged_at
+		FROM notes WHERE id = $1 AND user_id = $2
+	`
+	err := d.db.QueryRowContext(ctx, query, noteID, userID).Scan(&note.ID, &note.UserID, &note.Text, &note.NotifyAt,
+		&note.Recurrence, &note.Status, &note.SentAt, &note.Attempts, &note.CreatedAt, &note.DeletedAt, &note.AcknowledgedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, model.ErrNoteNotFound
@@ -78,16 +175,258 @@ func (d *DefaultRepository) GetNote(ctx context.Context, noteID model.NoteID, us
 	return note, nil
 }
 
-func (d *DefaultRepository) DeleteNote(ctx context.Context, noteID model.NoteID, userID model.UserID) error {
+func (d *DefaultRepository) UpdateNote(ctx context.Context, note model.Note, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "UpdateNote_repo")
+	defer span.End()
+
 	query := `
-		UPDATE notes SET deleted_at = NOW() WHERE id = $1 AND user_id = $2
+		UPDATE notes SET
+			text = $1,
+			-- перенос времени заново ставит напоминание в очередь
+			status = CASE WHEN notify_at <> $2 THEN 'pending' ELSE status END,
+			attempts = CASE WHEN notify_at <> $2 THEN 0 ELSE attempts END,
+			-- захват снимается только при переносе, иначе notifier может отправить напоминание повторно
+			claimed_by = CASE WHEN notify_at <> $2 THEN NULL ELSE claimed_by END,
+			claim_expires_at = CASE WHEN notify_at <> $2 THEN NULL ELSE claim_expires_at END,
+			notify_at = $2
+		WHERE id = $3 AND user_id = $4 AND status <> 'cancelled'
 	`
 
-	if _, err := d.db.ExecContext(ctx, query, noteID, userID); err != nil {
-		return fmt.Errorf("failed to delete note %d for user %d: %w", noteID, userID, err)
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, note.Text, note.NotifyAt, note.ID, note.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to update note %d for user %d: %w", note.ID, note.UserID, err)
+		}
+		return checkAffected(res)
+	})
+}
+
+func (d *DefaultRepository) DeleteNote(ctx context.Context, noteID model.NoteID, userID model.UserID, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "DeleteNote_repo")
+	defer span.End()
+
+	query := `
+		UPDATE notes SET status = 'cancelled', deleted_at = NOW() WHERE id = $1 AND user_id = $2
+	`
+
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, noteID, userID); err != nil {
+			return fmt.Errorf("failed to delete note %d for user %d: %w", noteID, userID, err)
+		}
+		return nil
+	})
+}
+
+func (d *DefaultRepository) SetRecurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, recurrence string, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "SetRecurrence_repo")
+	defer span.End()
+
+	query := `
+		UPDATE notes SET recurrence = $1 WHERE id = $2 AND user_id = $3 AND status = 'pending'
+	`
+
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, recurrence, noteID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to set recurrence for note %d for user %d: %w", noteID, userID, err)
+		}
+		return checkAffected(res)
+	})
+}
+
+func (d *DefaultRepository) PatchNote(ctx context.Context, noteID model.NoteID, userID model.UserID, patch model.NotePatch, messages []model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "PatchNote_repo")
+	defer span.End()
+
+	// Условия и CASE видят заметку до изменения. Повторение, как и в SetRecurrence, меняется только
+	// у ожидающей заметки, но перенос времени в том же запросе снова ставит ее в очередь.
+	query := `
+		UPDATE notes SET
+			text = COALESCE($1, text),
+			status = CASE WHEN notify_at <> COALESCE($2, notify_at) THEN 'pending' ELSE status END,
+			attempts = CASE WHEN notify_at <> COALESCE($2, notify_at) THEN 0 ELSE attempts END,
+			claimed_by = CASE WHEN notify_at <> COALESCE($2, notify_at) THEN NULL ELSE claimed_by END,
+			claim_expires_at = CASE WHEN notify_at <> COALESCE($2, notify_at) THEN NULL ELSE claim_expires_at END,
+			notify_at = COALESCE($2, notify_at),
+			recurrence = COALESCE($3, recurrence)
+		WHERE id = $4 AND user_id = $5 AND status <> 'cancelled'
+			AND ($3::text IS NULL OR status = 'pending' OR notify_at <> COALESCE($2, notify_at))
+	`
+
+	return d.withOutboxMessages(ctx, messages, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, patch.Text, patch.NotifyAt, patch.Recurrence, noteID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to patch note %d for user %d: %w", noteID, userID, err)
+		}
+		if err = checkAffected(res); !errors.Is(err, model.ErrNoteNotFound) || patch.Recurrence == nil {
+			return err
+		}
+		return patchMissReason(ctx, tx, noteID, userID)
+	})
+}
+
+// patchMissReason отличает отсутствующую заметку от заметки, у которой нельзя менять повторение
+func patchMissReason(ctx context.Context, tx *sql.Tx, noteID model.NoteID, userID model.UserID) error {
+	var status model.NoteStatus
+	err := tx.QueryRowContext(ctx, `SELECT status FROM notes WHERE id = $1 AND user_id = $2`, noteID, userID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) || status == model.NoteStatusCancelled {
+		return model.ErrNoteNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get status of note %d for user %d: %w", noteID, userID, err)
 	}
+	return model.ErrNoteNotPending
+}
 
-	return nil
+// SkipOccurrence переносит захваченное owner повторяющееся напоминание на следующее срабатывание без отправки,
+// время последней отправки не меняется
+func (d *DefaultRepository) SkipOccurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, notifyAt time.Time, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "SkipOccurrence_repo")
+	defer span.End()
+
+	query := `
+		UPDATE notes SET notify_at = $1, attempts = 0, claimed_by = NULL, claim_expires_at = NULL
+		WHERE id = $2 AND user_id = $3 AND status = 'pending' AND claimed_by = $4
+	`
+
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, notifyAt, noteID, userID, owner)
+		if err != nil {
+			return fmt.Errorf("failed to skip occurrence of note %d for user %d: %w", noteID, userID, err)
+		}
+		return checkClaimed(res)
+	})
+}
+
+// SnoozeNote откладывает напоминание, возвращая его в очередь на отправку
+func (d *DefaultRepository) SnoozeNote(ctx context.Context, noteID model.NoteID, userID model.UserID, notifyAt time.Time, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "SnoozeNote_repo")
+	defer span.End()
+
+	query := `
+		UPDATE notes SET notify_at = $1, status = 'pending', attempts = 0, acknowledged_at = NULL,
+			claimed_by = NULL, claim_expires_at = NULL
+		WHERE id = $2 AND user_id = $3 AND status <> 'cancelled'
+	`
+
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, notifyAt, noteID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to snooze note %d for user %d: %w", noteID, userID, err)
+		}
+		return checkAffected(res)
+	})
+}
+
+func (d *DefaultRepository) AcknowledgeNote(ctx context.Context, noteID model.NoteID, userID model.UserID, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "AcknowledgeNote_repo")
+	defer span.End()
+
+	query := `
+		UPDATE notes SET
+			acknowledged_at = NOW(),
+			-- повторяющаяся заметка остается в очереди на следующее срабатывание
+			status = CASE WHEN recurrence = '' THEN 'acknowledged' ELSE status END
+		WHERE id = $1 AND user_id = $2 AND status <> 'cancelled'
+	`
+
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, noteID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to acknowledge note %d for user %d: %w", noteID, userID, err)
+		}
+		return checkAffected(res)
+	})
+}
+
+// MarkSent одним запросом идемпотентно отмечает разовые напоминания отправленными,
+// повторяющиеся остаются в очереди. Возвращает число измененных заметок.
+func (d *DefaultRepository) MarkSent(ctx context.Context, refs []model.NoteRef) (int64, error) {
+	ctx, span := tracing.StartSpan(ctx, "MarkSent_repo")
+	defer span.End()
+
+	if len(refs) == 0 {
+		return 0, nil
+	}
+
+	noteIDs := make([]int64, len(refs))
+	userIDs := make([]int64, len(refs))
+	for i, ref := range refs {
+		noteIDs[i] = int64(ref.ID)
+		userIDs[i] = int64(ref.UserID)
+	}
+
+	query := `
+		UPDATE notes SET status = 'sent', sent_at = NOW(), attempts = attempts + 1,
+			claimed_by = NULL, claim_expires_at = NULL
+		FROM unnest($1::bigint[], $2::bigint[]) AS sent (id, user_id)
+		WHERE notes.id = sent.id AND notes.user_id = sent.user_id
+			AND notes.status = 'pending' AND notes.recurrence = ''
+	`
+
+	res, err := d.db.ExecContext(ctx, query, pq.Array(noteIDs), pq.Array(userIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark %d notes as sent: %w", len(refs), err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected, nil
+}
+
+// CompleteDelivery в одной транзакции фиксирует доставку захваченного owner напоминания и записывает сообщение в outbox.
+// Для повторяющейся заметки nextNotifyAt - следующее срабатывание, для разовой - nil.
+// Если захват уже перешел к другому экземпляру, возвращает ErrClaimLost и ничего не меняет.
+func (d *DefaultRepository) CompleteDelivery(ctx context.Context, note model.Note, owner string, nextNotifyAt *time.Time, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "CompleteDelivery_repo")
+	defer span.End()
+
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		var (
+			res sql.Result
+			err error
+		)
+		if nextNotifyAt != nil {
+			query := `
+				UPDATE notes SET notify_at = $1, sent_at = NOW(), attempts = 0, claimed_by = NULL, claim_expires_at = NULL
+				WHERE id = $2 AND user_id = $3 AND status = 'pending' AND claimed_by = $4
+			`
+			res, err = tx.ExecContext(ctx, query, *nextNotifyAt, note.ID, note.UserID, owner)
+		} else {
+			query := `
+				UPDATE notes SET status = 'sent', sent_at = NOW(), attempts = attempts + 1,
+					claimed_by = NULL, claim_expires_at = NULL
+				WHERE id = $1 AND user_id = $2 AND status = 'pending' AND claimed_by = $3
+			`
+			res, err = tx.ExecContext(ctx, query, note.ID, note.UserID, owner)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to complete delivery of note %d for user %d: %w", note.ID, note.UserID, err)
+		}
+		return checkClaimed(res)
+	})
+}
+
+// MarkFailed отмечает захваченное owner напоминание недоставленным
+func (d *DefaultRepository) MarkFailed(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, message model.OutboxMessage) error {
+	ctx, span := tracing.StartSpan(ctx, "MarkFailed_repo")
+	defer span.End()
+
+	query := `
+		UPDATE notes SET status = 'failed', attempts = attempts + 1,
+			claimed_by = NULL, claim_expires_at = NULL
+		WHERE id = $1 AND user_id = $2 AND status = 'pending' AND claimed_by = $3
+	`
+
+	return d.withOutbox(ctx, message, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, noteID, userID, owner)
+		if err != nil {
+			return fmt.Errorf("failed to mark note %d for user %d as failed: %w", noteID, userID, err)
+		}
+		return checkClaimed(res)
+	})
 }
 
 func (d *DefaultRepository) ListNotes(ctx context.Context, userID model.UserID, showDeleted bool) ([]model.Note, error) {
@@ -98,16 +437,21 @@ func (d *DefaultRepository) ListNotes(ctx context.Context, userID model.UserID,
 		Select("id",
 			"text",
 			"notify_at",
+			"recurrence",
+			"status",
+			"sent_at",
+			"attempts",
 			"created_at",
-			"deleted_at").
+			"deleted_at",
+			"acknowledged_at").
 		From("notes").
 		Where(squirrel.Eq{"user_id": userID})
 
 	if !showDeleted {
-		queryBuilder = queryBuilder.Where("deleted_at IS NULL")
+		queryBuilder = queryBuilder.Where(squirrel.Eq{"status": model.NoteStatusPending})
 	}
 
-	queryBuilder = queryBuilder.OrderBy("deleted_at DESC, notify_at").
+	queryBuilder = queryBuilder.OrderBy("status <> 'pending', notify_at").
 		PlaceholderFormat(squirrel.Dollar)
 
 	query, args, err := queryBuilder.ToSql()
@@ -124,7 +468,8 @@ func (d *DefaultRepository) ListNotes(ctx context.Context, userID model.UserID,
 	var notes []model.Note
 	for rows.Next() {
 		var note model.Note
-		if err = rows.Scan(&note.ID, &note.Text, &note.NotifyAt, &note.CreatedAt, &note.DeletedAt); err != nil {
+		if err = rows.Scan(&note.ID, &note.Text, &note.NotifyAt, &note.Recurrence, &note.Status, &note.SentAt,
+			&note.Attempts, &note.CreatedAt, &note.DeletedAt, &note.AcknowledgedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 		notes = append(notes, note)
@@ -133,38 +478,202 @@ func (d *DefaultRepository) ListNotes(ctx context.Context, userID model.UserID,
 	return notes, nil
 }
 
-func (d *DefaultRepository) ReceiveNotifications(ctx context.Context, startTime, endTime time.Time) ([]model.Note, error) {
+// ListNotesPage возвращает до filter.Limit заметок пользователя с id больше filter.AfterID
+func (d *DefaultRepository) ListNotesPage(ctx context.Context, userID model.UserID, filter model.NoteFilter) ([]model.Note, error) {
+	ctx, span := tracing.StartSpan(ctx, "ListNotesPage_repo")
+	defer span.End()
+
 	queryBuilder := squirrel.
 		Select("id",
 			"user_id",
 			"text",
 			"notify_at",
-			"created_at").
+			"recurrence",
+			"status",
+			"sent_at",
+			"attempts",
+			"created_at",
+			"deleted_at",
+			"acknowledged_at").
 		From("notes").
-		Where("deleted_at IS NULL").
-		Where("notify_at >= ? AND notify_at < ?", startTime, endTime).
-		OrderBy("notify_at").
-		PlaceholderFormat(squirrel.Dollar)
+		Where(squirrel.Eq{"user_id": userID}).
+		Where(squirrel.Gt{"id": filter.AfterID})
 
-	query, args, err := queryBuilder.ToSql()
+	if filter.Status != "" {
+		queryBuilder = queryBuilder.Where(squirrel.Eq{"status": filter.Status})
+	}
+	if filter.Deleted != nil {
+		if *filter.Deleted {
+			queryBuilder = queryBuilder.Where(squirrel.NotEq{"deleted_at": nil})
+		} else {
+			queryBuilder = queryBuilder.Where(squirrel.Eq{"deleted_at": nil})
+		}
+	}
+
+	query, args, err := queryBuilder.OrderBy("id").
+		Limit(uint64(filter.Limit)).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
 	rows, err := d.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query receive notifications: %w", err)
+		return nil, fmt.Errorf("failed to query notes: %w", err)
 	}
 	defer rows.Close()
 
-	var notes []model.Note
+	notes := make([]model.Note, 0, filter.Limit)
 	for rows.Next() {
 		var note model.Note
-		if err = rows.Scan(&note.ID, &note.UserID, &note.Text, &note.NotifyAt, &note.CreatedAt); err != nil {
+		if err = rows.Scan(&note.ID, &note.UserID, &note.Text, &note.NotifyAt, &note.Recurrence, &note.Status, &note.SentAt,
+			&note.Attempts, &note.CreatedAt, &note.DeletedAt, &note.AcknowledgedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 		notes = append(notes, note)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
 
 	return notes, nil
 }
+
+// ClaimNotifications захватывает до limit наступивших напоминаний за владельцем owner на время lease.
+// Строки, захваченные другими экземплярами, пропускаются (SKIP LOCKED), захваты с истекшим
+// сроком (владелец упал) перехватываются. Возвращает заметки и число перехваченных захватов.
+func (d *DefaultRepository) ClaimNotifications(ctx context.Context, owner string, dueBefore time.Time, lease time.Duration, limit int) ([]model.Note, int, error) {
+	ctx, span := tracing.StartSpan(ctx, "ClaimNotifications_repo")
+	defer span.End()
+
+	query := `
+		UPDATE notes n SET claimed_by = $1, claim_expires_at = NOW() + make_interval(secs => $2)
+		FROM (
+			SELECT id, claimed_by AS prev_owner FROM notes
+			WHERE status = 'pending' AND notify_at < $3
+				AND (claim_expires_at IS NULL OR claim_expires_at < NOW())
+				AND user_id NOT IN (SELECT id FROM users WHERE delivery_state IN ('blocked', 'chat_not_found'))
+			ORDER BY notify_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		) c
+		WHERE n.id = c.id
+		RETURNING n.id, n.user_id, n.text, n.notify_at, n.recurrence, n.created_at, c.prev_owner IS NOT NULL
+	`
+
+	rows, err := d.db.QueryContext(ctx, query, owner, lease.Seconds(), dueBefore, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to claim notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		notes     []model.Note
+		reclaimed int
+	)
+	for rows.Next() {
+		var (
+			note         model.Note
+			wasReclaimed bool
+		)
+		if err = rows.Scan(&note.ID, &note.UserID, &note.Text, &note.NotifyAt, &note.Recurrence, &note.CreatedAt, &wasReclaimed); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan note: %w", err)
+		}
+		if wasReclaimed {
+			reclaimed++
+		}
+		notes = append(notes, note)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to claim notifications: %w", err)
+	}
+
+	return notes, reclaimed, nil
+}
+
+// ClaimStats число действующих и просроченных захватов напоминаний
+func (d *DefaultRepository) ClaimStats(ctx context.Context) (model.ClaimStats, error) {
+	ctx, span := tracing.StartSpan(ctx, "ClaimStats_repo")
+	defer span.End()
+
+	var stats model.ClaimStats
+	query := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE claimed_by IS NOT NULL AND claim_expires_at >= NOW()),
+			COUNT(*) FILTER (WHERE claimed_by IS NOT NULL AND claim_expires_at < NOW())
+		FROM notes
+		WHERE status = 'pending'
+	`
+	if err := d.db.QueryRowContext(ctx, query).Scan(&stats.Pending, &stats.Active, &stats.Expired); err != nil {
+		return model.ClaimStats{}, fmt.Errorf("failed to get claim stats: %w", err)
+	}
+	return stats, nil
+}
+
+// withOutbox выполняет update и запись message в outbox в одной транзакции.
+// Если update вернул ошибку, транзакция откатывается и сообщение не пишется.
+func (d *DefaultRepository) withOutbox(ctx context.Context, message model.OutboxMessage, update func(tx *sql.Tx) error) error {
+	return d.withOutboxMessages(ctx, []model.OutboxMessage{message}, update)
+}
+
+// withOutboxMessages как withOutbox, но пишет в outbox несколько сообщений
+func (d *DefaultRepository) withOutboxMessages(ctx context.Context, messages []model.OutboxMessage, update func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin note transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = update(tx); err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if err = insertOutbox(ctx, tx, message); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit note transaction: %w", err)
+	}
+	return nil
+}
+
+func insertOutbox(ctx context.Context, tx *sql.Tx, message model.OutboxMessage) error {
+	headers, err := json.Marshal(message.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox headers: %w", err)
+	}
+
+	query := `INSERT INTO outbox (key, value, headers) VALUES ($1, $2, $3)`
+	if _, err = tx.ExecContext(ctx, query, message.Key, message.Value, string(headers)); err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+	return nil
+}
+
+// checkClaimed возвращает ErrClaimLost, если запрос не изменил захваченную строку
+func checkClaimed(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return model.ErrClaimLost
+	}
+	return nil
+}
+
+// checkAffected возвращает ErrNoteNotFound, если запрос не изменил ни одной строки
+func checkAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return model.ErrNoteNotFound
+	}
+	return nil
+}
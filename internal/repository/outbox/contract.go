@@ -0,0 +1,18 @@
+package outbox
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/model"
+	"time"
+)
+
+type (
+	Repository interface {
+		// PublishBatch захватывает для owner на lease до limit неопубликованных сообщений и передает их в publish
+		// одной партией по порядку. Publish выполняется вне транзакции. Если он успешен, партия отмечается
+		// опубликованной, иначе у каждого сообщения записывается ошибка и захват снимается.
+		PublishBatch(ctx context.Context, owner string, lease time.Duration, limit int, publish func([]model.OutboxMessage) error) (int, error)
+		// PurgePublished удаляет сообщения, опубликованные раньше before
+		PurgePublished(ctx context.Context, before time.Time) (int64, error)
+	}
+)
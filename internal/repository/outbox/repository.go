@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/model"
+	"github.com/lib/pq"
+	"slices"
+	"time"
+)
+
+type DefaultRepository struct {
+	db *sql.DB
+}
+
+func NewDefaultRepository(pg *sql.DB) *DefaultRepository {
+	return &DefaultRepository{pg}
+}
+
+// outboxClaimLock ключ advisory-блокировки, сериализующей захват партий outbox
+const outboxClaimLock = 7_210_001
+
+func (d *DefaultRepository) PublishBatch(ctx context.Context, owner string, lease time.Duration, limit int, publish func([]model.OutboxMessage) error) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "PublishBatch_repo")
+	defer span.End()
+
+	messages, err := d.claimBatch(ctx, owner, lease, limit)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int64, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+
+	// Результат публикации записывается и при остановке relay, иначе сообщения ждали бы истечения захвата
+	markCtx := context.WithoutCancel(ctx)
+	if publishErr := publish(messages); publishErr != nil {
+		query := `
+			UPDATE outbox SET attempts = attempts + 1, last_error = $1, claimed_by = NULL, claim_expires_at = NULL
+			WHERE id = ANY($2) AND claimed_by = $3 AND published_at IS NULL
+		`
+		if _, err = d.db.ExecContext(markCtx, query, publishErr.Error(), pq.Array(ids), owner); err != nil {
+			return 0, fmt.Errorf("failed to release %d outbox messages: %w", len(messages), err)
+		}
+		return 0, fmt.Errorf("failed to publish %d outbox messages: %w", len(messages), publishErr)
+	}
+
+	query := `
+		UPDATE outbox SET published_at = NOW(), attempts = attempts + 1, last_error = NULL, claimed_by = NULL, claim_expires_at = NULL
+		WHERE id = ANY($1)
+	`
+	if _, err = d.db.ExecContext(markCtx, query, pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("failed to mark %d outbox messages published: %w", len(messages), err)
+	}
+	return len(messages), nil
+}
+
+// claimBatch захватывает для owner до limit неопубликованных сообщений в порядке записи.
+// Сообщение пользователя не захватывается, пока более раннее его сообщение захвачено другим relay,
+// поэтому события одного пользователя публикуются по порядку при нескольких экземплярах notifier.
+func (d *DefaultRepository) claimBatch(ctx context.Context, owner string, lease time.Duration, limit int) ([]model.OutboxMessage, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin outbox transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Захваты идут по одному: два relay, захватывающие одновременно, не видели бы захваты друг друга
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, outboxClaimLock); err != nil {
+		return nil, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+
+	query := `
+		UPDATE outbox SET claimed_by = $1, claim_expires_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT o.id FROM outbox o
+			WHERE o.published_at IS NULL
+				AND (o.claim_expires_at IS NULL OR o.claim_expires_at < NOW())
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox p
+					WHERE p.key = o.key AND p.id < o.id AND p.published_at IS NULL AND p.claim_expires_at >= NOW()
+				)
+			ORDER BY o.id
+			LIMIT $3
+		)
+		RETURNING id, key, value, headers, attempts, created_at
+	`
+	rows, err := tx.QueryContext(ctx, query, owner, lease.Seconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	var messages []model.OutboxMessage
+	for rows.Next() {
+		var (
+			message model.OutboxMessage
+			headers []byte
+		)
+		if err = rows.Scan(&message.ID, &message.Key, &message.Value, &headers, &message.Attempts, &message.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		if err = json.Unmarshal(headers, &message.Headers); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to decode headers of outbox message %d: %w", message.ID, err)
+		}
+		messages = append(messages, message)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit outbox claim: %w", err)
+	}
+
+	// RETURNING не сохраняет порядок подзапроса
+	slices.SortFunc(messages, func(a, b model.OutboxMessage) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return messages, nil
+}
+
+func (d *DefaultRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracing.StartSpan(ctx, "PurgePublished_repo")
+	defer span.End()
+
+	query := `DELETE FROM outbox WHERE published_at < $1`
+	res, err := d.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge published outbox messages: %w", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,16 @@
+package tokens
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/model"
+)
+
+type (
+	// Repository хранит хеши API-токенов пользователей
+	Repository interface {
+		CreateToken(ctx context.Context, userID model.UserID, hash []byte) error
+		// UserByToken возвращает владельца действующего токена и отмечает его использование
+		UserByToken(ctx context.Context, hash []byte) (model.UserID, error)
+		RevokeTokens(ctx context.Context, userID model.UserID) (int64, error)
+	}
+)
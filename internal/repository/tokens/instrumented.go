@@ -0,0 +1,44 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"github.com/kotche/bot/internal/model"
+	"time"
+)
+
+// InstrumentedRepository пишет метрики длительности и ошибок каждого метода репозитория
+type InstrumentedRepository struct {
+	repo Repository
+}
+
+func NewInstrumentedRepository(repo Repository) *InstrumentedRepository {
+	return &InstrumentedRepository{repo: repo}
+}
+
+// observe учитывает запрос, неизвестный токен ошибкой не считается
+func observe(method string, start time.Time, err error) {
+	metrics.ObserveQuery("tokens", method, start, err != nil && !errors.Is(err, model.ErrInvalidToken))
+}
+
+func (r *InstrumentedRepository) CreateToken(ctx context.Context, userID model.UserID, hash []byte) error {
+	start := time.Now()
+	err := r.repo.CreateToken(ctx, userID, hash)
+	observe("CreateToken", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository) UserByToken(ctx context.Context, hash []byte) (model.UserID, error) {
+	start := time.Now()
+	result, err := r.repo.UserByToken(ctx, hash)
+	observe("UserByToken", start, err)
+	return result, err
+}
+
+func (r *InstrumentedRepository) RevokeTokens(ctx context.Context, userID model.UserID) (int64, error) {
+	start := time.Now()
+	result, err := r.repo.RevokeTokens(ctx, userID)
+	observe("RevokeTokens", start, err)
+	return result, err
+}
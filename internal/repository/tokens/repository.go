@@ -0,0 +1,68 @@
+package tokens
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/model"
+)
+
+type DefaultRepository struct {
+	db *sql.DB
+}
+
+func NewDefaultRepository(pg *sql.DB) *DefaultRepository {
+	return &DefaultRepository{pg}
+}
+
+func (d *DefaultRepository) CreateToken(ctx context.Context, userID model.UserID, hash []byte) error {
+	ctx, span := tracing.StartSpan(ctx, "CreateToken_repo")
+	defer span.End()
+
+	query := `INSERT INTO api_tokens (user_id, token_hash, created_at) VALUES ($1, $2, NOW())`
+	if _, err := d.db.ExecContext(ctx, query, userID, hash); err != nil {
+		return fmt.Errorf("failed to create api token for user '%d': %w", userID, err)
+	}
+	return nil
+}
+
+func (d *DefaultRepository) UserByToken(ctx context.Context, hash []byte) (model.UserID, error) {
+	ctx, span := tracing.StartSpan(ctx, "UserByToken_repo")
+	defer span.End()
+
+	query := `
+		UPDATE api_tokens t SET last_used_at = NOW()
+		FROM users u
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND u.id = t.user_id AND u.deleted_at IS NULL
+		RETURNING t.user_id
+	`
+
+	var userID model.UserID
+	if err := d.db.QueryRowContext(ctx, query, hash).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, model.ErrInvalidToken
+		}
+		return 0, fmt.Errorf("failed to get user by api token: %w", err)
+	}
+	return userID, nil
+}
+
+// RevokeTokens отзывает все токены пользователя, возвращает число отозванных
+func (d *DefaultRepository) RevokeTokens(ctx context.Context, userID model.UserID) (int64, error) {
+	ctx, span := tracing.StartSpan(ctx, "RevokeTokens_repo")
+	defer span.End()
+
+	query := `UPDATE api_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	res, err := d.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke api tokens of user '%d': %w", userID, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected, nil
+}
@@ -0,0 +1,18 @@
+package dialog
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/model"
+)
+
+type (
+	Service interface {
+		Start(ctx context.Context, chatID model.ChatID) (*model.Dialog, error)
+		StartEdit(ctx context.Context, chatID model.ChatID, note model.Note) (*model.Dialog, error)
+		Get(ctx context.Context, chatID model.ChatID) (*model.Dialog, error)
+		Save(ctx context.Context, dialog model.Dialog) error
+		Cancel(ctx context.Context, chatID model.ChatID) error
+		// EvictExpired удаляет брошенные диалоги, простоявшие дольше ttl
+		EvictExpired(ctx context.Context) (int64, error)
+	}
+)
@@ -0,0 +1,81 @@
+package dialog
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/repository/dialog"
+	"time"
+)
+
+type DefaultService struct {
+	repo dialog.Repository
+	ttl  time.Duration
+}
+
+// NewDefaultService ttl - время простоя, после которого диалог считается истекшим
+func NewDefaultService(repo dialog.Repository, ttl time.Duration) *DefaultService {
+	return &DefaultService{repo: repo, ttl: ttl}
+}
+
+func (d *DefaultService) Start(ctx context.Context, chatID model.ChatID) (*model.Dialog, error) {
+	dialog := model.Dialog{
+		ChatID:    chatID,
+		State:     model.DialogStateAwaitingText,
+		UpdatedAt: time.Now(),
+	}
+
+	if err := d.repo.SaveDialog(ctx, dialog); err != nil {
+		return nil, err
+	}
+
+	return &dialog, nil
+}
+
+func (d *DefaultService) StartEdit(ctx context.Context, chatID model.ChatID, note model.Note) (*model.Dialog, error) {
+	dialog := model.Dialog{
+		ChatID:    chatID,
+		State:     model.DialogStateEditChoice,
+		Text:      note.Text,
+		NotifyAt:  note.NotifyAt,
+		NoteID:    note.ID,
+		UpdatedAt: time.Now(),
+	}
+
+	if err := d.repo.SaveDialog(ctx, dialog); err != nil {
+		return nil, err
+	}
+
+	return &dialog, nil
+}
+
+func (d *DefaultService) Get(ctx context.Context, chatID model.ChatID) (*model.Dialog, error) {
+	dialog, err := d.repo.GetDialog(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ttl > 0 && time.Since(dialog.UpdatedAt) > d.ttl {
+		if err = d.repo.DeleteDialog(ctx, chatID); err != nil {
+			return nil, err
+		}
+		return nil, model.ErrDialogExpired
+	}
+
+	return dialog, nil
+}
+
+func (d *DefaultService) Save(ctx context.Context, dialog model.Dialog) error {
+	dialog.UpdatedAt = time.Now()
+	return d.repo.SaveDialog(ctx, dialog)
+}
+
+func (d *DefaultService) Cancel(ctx context.Context, chatID model.ChatID) error {
+	return d.repo.DeleteDialog(ctx, chatID)
+}
+
+func (d *DefaultService) EvictExpired(ctx context.Context) (int64, error) {
+	if d.ttl <= 0 {
+		return 0, nil
+	}
+	return d.repo.DeleteExpiredDialogs(ctx, time.Now().Add(-d.ttl))
+}
@@ -1,9 +1,40 @@
 package kafka
 
-import "context"
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Message прочитанное сообщение, позиция нужна для ручного коммита offset
+type Message struct {
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// Context возвращает ctx с контекстом трассировки из заголовков сообщения
+func (m Message) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(m.Headers))
+}
+
+// TraceHeaders заголовки трассировки (traceparent, tracestate) для отправляемого сообщения
+func TraceHeaders(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
 
 type MessageBroker interface {
 	SendMessage(ctx context.Context, key, value []byte) error
+	// SendMessages отправляет партию одним запросом. Сообщение без Headers получает заголовки трассировки из ctx.
+	SendMessages(ctx context.Context, msgs ...Message) error
 	ReadMessage(ctx context.Context) (key, value []byte, err error)
+	// FetchMessage читает сообщение без коммита offset, коммит - через CommitMessages
+	FetchMessage(ctx context.Context) (Message, error)
+	CommitMessages(ctx context.Context, msgs ...Message) error
 	Close() error
 }
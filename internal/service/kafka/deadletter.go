@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DeadLetter сообщение dead-letter топика: исходное сообщение с заголовками, его позиция и причина ошибки
+type DeadLetter struct {
+	Topic     string            `json:"topic"`
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       []byte            `json:"key"`
+	Value     []byte            `json:"value"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Error     string            `json:"error"`
+	FailedAt  time.Time         `json:"failed_at"`
+}
+
+// EncodeDeadLetter возвращает ключ и значение сообщения для dead-letter топика, ключ исходный
+func EncodeDeadLetter(msg Message, cause error) (key, value []byte, err error) {
+	value, err = json.Marshal(DeadLetter{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   msg.Headers,
+		Error:     cause.Error(),
+		FailedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+	return msg.Key, value, nil
+}
+
+func DecodeDeadLetter(value []byte) (DeadLetter, error) {
+	var letter DeadLetter
+	if err := json.Unmarshal(value, &letter); err != nil {
+		return DeadLetter{}, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	return letter, nil
+}
@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestDeadLetterRoundTrip(t *testing.T) {
+	msg := Message{
+		Key:       []byte("7"),
+		Value:     []byte(`{"v":1}`),
+		Headers:   map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "source": "writer"},
+		Topic:     "notes",
+		Partition: 2,
+		Offset:    42,
+	}
+
+	key, value, err := EncodeDeadLetter(msg, errors.New("boom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "7" {
+		t.Fatalf("key = %q, want original key", key)
+	}
+
+	letter, err := DecodeDeadLetter(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if letter.Topic != msg.Topic || letter.Partition != msg.Partition || letter.Offset != msg.Offset {
+		t.Fatalf("position = %s[%d]@%d, want notes[2]@42", letter.Topic, letter.Partition, letter.Offset)
+	}
+	if string(letter.Key) != "7" || string(letter.Value) != `{"v":1}` || letter.Error != "boom" {
+		t.Fatalf("letter = %+v", letter)
+	}
+	if !maps.Equal(letter.Headers, msg.Headers) {
+		t.Fatalf("headers = %v, want %v", letter.Headers, msg.Headers)
+	}
+}
+
+func TestDecodeDeadLetterRejectsMalformed(t *testing.T) {
+	if _, err := DecodeDeadLetter([]byte("{")); !errors.Is(err, ErrMalformedEvent) {
+		t.Fatalf("error = %v, want ErrMalformedEvent", err)
+	}
+}
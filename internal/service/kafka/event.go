@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kotche/bot/internal/model"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion текущая версия схемы события. Версия 0 - старый формат:
+// ключ - id пользователя, значение - id заметки в десятичном виде.
+const SchemaVersion = 1
+
+type EventType string
+
+const (
+	EventNoteCreated      EventType = "note.created"
+	EventNoteUpdated      EventType = "note.updated"
+	EventNoteDeleted      EventType = "note.deleted"
+	EventNoteRecurrence   EventType = "note.recurrence_set"
+	EventNoteRescheduled  EventType = "note.rescheduled"
+	EventNoteSnoozed      EventType = "note.snoozed"
+	EventNoteAcknowledged EventType = "note.acknowledged"
+	EventNoteDelivered    EventType = "note.delivered"
+	EventNoteFailed       EventType = "note.failed"
+)
+
+var (
+	ErrMalformedEvent     = errors.New("malformed event")
+	ErrUnsupportedVersion = errors.New("unsupported event schema version")
+)
+
+// Event событие о заметке в топике, ключ сообщения - id пользователя.
+// Text и Recurrence заполняются, только если событие их меняет.
+type Event struct {
+	Version    int          `json:"version"`
+	Type       EventType    `json:"type"`
+	NoteID     model.NoteID `json:"note_id"`
+	UserID     model.UserID `json:"user_id"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	NotifyAt   *time.Time   `json:"notify_at,omitempty"`
+	Text       string       `json:"text,omitempty"`
+	Recurrence *string      `json:"recurrence,omitempty"`
+}
+
+// NewEvent создает событие текущей версии. Контекст трассировки передается в заголовках сообщения, не в событии.
+func NewEvent(eventType EventType, noteID model.NoteID, userID model.UserID) Event {
+	return Event{
+		Version:    SchemaVersion,
+		Type:       eventType,
+		NoteID:     noteID,
+		UserID:     userID,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// EncodeEvent возвращает ключ и значение сообщения для события
+func EncodeEvent(event Event) (key, value []byte, err error) {
+	value, err = json.Marshal(event)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	return []byte(strconv.FormatInt(int64(event.UserID), 10)), value, nil
+}
+
+// DecodeEvent разбирает сообщение в формате любой поддерживаемой версии, включая старый
+func DecodeEvent(key, value []byte) (Event, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+		return decodeLegacyEvent(key, value)
+	}
+
+	var event Event
+	if err := json.Unmarshal(value, &event); err != nil {
+		return Event{}, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	if event.Version < 1 || event.Version > SchemaVersion {
+		return Event{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, event.Version)
+	}
+	if event.Type == "" || event.NoteID == 0 || event.UserID == 0 {
+		return Event{}, fmt.Errorf("%w: type, note_id and user_id are required", ErrMalformedEvent)
+	}
+
+	return event, nil
+}
+
+// decodeLegacyEvent разбирает сообщение версии 0, такие сообщения означали только доставку
+func decodeLegacyEvent(key, value []byte) (Event, error) {
+	userID, err := strconv.ParseInt(string(key), 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("%w: bad user id '%s'", ErrMalformedEvent, key)
+	}
+
+	noteID, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("%w: bad note id '%s'", ErrMalformedEvent, value)
+	}
+
+	return Event{
+		Version: 0,
+		Type:    EventNoteDelivered,
+		NoteID:  model.NoteID(noteID),
+		UserID:  model.UserID(userID),
+	}, nil
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"errors"
+	"github.com/kotche/bot/internal/model"
+	"testing"
+	"time"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	occurredAt := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  Event
+	}{
+		{
+			name:  "v0 delivery",
+			key:   "7",
+			value: "42",
+			want:  Event{Version: 0, Type: EventNoteDelivered, NoteID: 42, UserID: 7},
+		},
+		{
+			name:  "v1",
+			key:   "7",
+			value: `{"version":1,"type":"note.delivered","note_id":42,"user_id":7,"occurred_at":"2024-05-01T09:00:00Z"}`,
+			want:  Event{Version: 1, Type: EventNoteDelivered, NoteID: 42, UserID: 7, OccurredAt: occurredAt},
+		},
+		{
+			name:  "v1 with unknown fields",
+			key:   "7",
+			value: ` {"version":1,"type":"note.updated","note_id":42,"user_id":7,"occurred_at":"2024-05-01T09:00:00Z","text":"milk","extra":true}`,
+			want:  Event{Version: 1, Type: EventNoteUpdated, NoteID: 42, UserID: 7, OccurredAt: occurredAt, Text: "milk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeEvent([]byte(tt.key), []byte(tt.value))
+			if err != nil {
+				t.Fatalf("DecodeEvent: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("DecodeEvent = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEventRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  error
+	}{
+		{name: "unknown version", key: "7", value: `{"version":2,"type":"note.delivered","note_id":42,"user_id":7}`, want: ErrUnsupportedVersion},
+		{name: "zero version in json", key: "7", value: `{"type":"note.delivered","note_id":42,"user_id":7}`, want: ErrUnsupportedVersion},
+		{name: "malformed json", key: "7", value: `{"version":1,"type":`, want: ErrMalformedEvent},
+		{name: "missing note id", key: "7", value: `{"version":1,"type":"note.delivered","user_id":7}`, want: ErrMalformedEvent},
+		{name: "v0 bad note id", key: "7", value: "abc", want: ErrMalformedEvent},
+		{name: "v0 bad user id", key: "user", value: "42", want: ErrMalformedEvent},
+		{name: "empty", key: "", value: "", want: ErrMalformedEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeEvent([]byte(tt.key), []byte(tt.value)); !errors.Is(err, tt.want) {
+				t.Fatalf("DecodeEvent error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeEventRoundTrip(t *testing.T) {
+	recurrence := "daily 09:00"
+	event := NewEvent(EventNoteRecurrence, 42, 7)
+	event.Recurrence = &recurrence
+
+	key, value, err := EncodeEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "7" {
+		t.Fatalf("key = %q, want user id", key)
+	}
+
+	got, err := DecodeEvent(key, value)
+	if err != nil {
+		t.Fatalf("DecodeEvent: %v", err)
+	}
+	if got.Type != event.Type || got.NoteID != model.NoteID(42) || got.UserID != model.UserID(7) ||
+		got.Recurrence == nil || *got.Recurrence != recurrence || !got.OccurredAt.Equal(event.OccurredAt) {
+		t.Fatalf("DecodeEvent = %+v, want %+v", got, event)
+	}
+}
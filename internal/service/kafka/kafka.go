@@ -4,12 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/kotche/bot/infrastructure/metrics"
 	"github.com/segmentio/kafka-go"
 	"log"
 	"time"
 )
 
+const (
+	// writerBatchSize и writerBatchTimeout: партия уходит в kafka, когда набралась или истекло ожидание.
+	// По умолчанию в kafka-go ожидание 1с, и каждая одиночная отправка задерживалась на секунду.
+	writerBatchSize    = 100
+	writerBatchTimeout = 10 * time.Millisecond
+)
+
+var ErrNoConsumer = errors.New("kafka service has no consumer group")
+
 type Service struct {
+	brokers  []string
 	producer *kafka.Writer
 	consumer *kafka.Reader
 }
@@ -21,48 +32,138 @@ func New(brokers []string, topic string, groupID string, numPartitions, replicat
 		}
 	}
 
+	// Партиция выбирается по ключу, чтобы события одного пользователя шли по порядку
 	producer := &kafka.Writer{
-		Addr:     kafka.TCP(brokers...),
-		Topic:    topic,
-		Balancer: &kafka.LeastBytes{},
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    writerBatchSize,
+		BatchTimeout: writerBatchTimeout,
+	}
+
+	// Без группы сервис только публикует сообщения
+	if groupID == "" {
+		return &Service{brokers: brokers, producer: producer}, nil
 	}
 
 	consumer := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		Topic:          topic,
-		GroupID:        groupID,
-		CommitInterval: time.Second,
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: groupID,
+		// Коммит синхронный: CommitMessages возвращается после записи offset в kafka
+		CommitInterval: 0,
 	})
 
 	return &Service{
+		brokers:  brokers,
 		producer: producer,
 		consumer: consumer,
 	}, nil
 }
 
 func (s *Service) SendMessage(ctx context.Context, key, value []byte) error {
-	err := s.producer.WriteMessages(ctx, kafka.Message{
-		Key:   key,
-		Value: value,
-	})
+	return s.SendMessages(ctx, Message{Key: key, Value: value})
+}
+
+func (s *Service) SendMessages(ctx context.Context, msgs ...Message) error {
+	ctxHeaders := TraceHeaders(ctx)
+
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		msgHeaders := msg.Headers
+		if len(msgHeaders) == 0 {
+			msgHeaders = ctxHeaders
+		}
+
+		var headers []kafka.Header
+		for name, value := range msgHeaders {
+			headers = append(headers, kafka.Header{Key: name, Value: []byte(value)})
+		}
+		kafkaMsgs = append(kafkaMsgs, kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers})
+	}
+
+	err := s.producer.WriteMessages(ctx, kafkaMsgs...)
+	for range msgs {
+		metrics.ObserveProduce(s.producer.Topic, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to send message to kafka: %v", err)
+		return fmt.Errorf("failed to send %d messages to kafka: %v", len(msgs), err)
 	}
 	return nil
 }
 
 func (s *Service) ReadMessage(ctx context.Context) (key, value []byte, err error) {
+	if s.consumer == nil {
+		return nil, nil, ErrNoConsumer
+	}
 	msg, err := s.consumer.ReadMessage(ctx)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read message from kafka: %v", err)
 	}
+	metrics.KafkaConsumedCounter.WithLabelValues(msg.Topic).Inc()
+	metrics.KafkaConsumerLagGauge.WithLabelValues(msg.Topic).Set(float64(s.consumer.Lag()))
 	return msg.Key, msg.Value, nil
 }
 
+func (s *Service) FetchMessage(ctx context.Context) (Message, error) {
+	if s.consumer == nil {
+		return Message{}, ErrNoConsumer
+	}
+	msg, err := s.consumer.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to fetch message from kafka: %w", err)
+	}
+	metrics.KafkaConsumedCounter.WithLabelValues(msg.Topic).Inc()
+	metrics.KafkaConsumerLagGauge.WithLabelValues(msg.Topic).Set(float64(s.consumer.Lag()))
+	headers := make(map[string]string, len(msg.Headers))
+	for _, header := range msg.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+
+	return Message{
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}, nil
+}
+
+func (s *Service) CommitMessages(ctx context.Context, msgs ...Message) error {
+	if s.consumer == nil {
+		return ErrNoConsumer
+	}
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		kafkaMsgs = append(kafkaMsgs, kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset})
+	}
+	if err := s.consumer.CommitMessages(ctx, kafkaMsgs...); err != nil {
+		return fmt.Errorf("failed to commit kafka messages: %w", err)
+	}
+	return nil
+}
+
+// Ping проверяет, что хотя бы один брокер kafka доступен
+func (s *Service) Ping(ctx context.Context) error {
+	var errs []error
+	for _, broker := range s.brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn.Close()
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no kafka broker available: %w", errors.Join(errs...))
+}
+
 func (s *Service) Close() error {
 	if err := s.producer.Close(); err != nil {
 		return fmt.Errorf("failed to close kafka producer: %w", err)
 	}
+	if s.consumer == nil {
+		return nil
+	}
 	if err := s.consumer.Close(); err != nil {
 		return fmt.Errorf("failed to close kafka consumer: %w", err)
 	}
@@ -0,0 +1,227 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"github.com/kotche/bot/infrastructure/metrics"
+	"io"
+	"sync"
+)
+
+// memoryRetention сколько последних сообщений топика хранится, даже если их не закоммитили
+const memoryRetention = 10000
+
+// MemoryLog хранилище топиков в памяти процесса, заменяет kafka в тестах и при запуске одним процессом.
+// У топика одна партиция, сообщения удаляются, когда их закоммитили все группы. Как retention в kafka,
+// в топике остается не больше memoryRetention сообщений: отстающие группы их теряют.
+type MemoryLog struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	// base offset первого хранимого сообщения
+	base     int64
+	messages []Message
+	groups   map[string]*memoryGroup
+	// notify закрывается и заменяется при появлении новых сообщений
+	notify chan struct{}
+}
+
+// memoryGroup позиция группы потребителей: участники группы делят одну очередь,
+// каждое сообщение получает один из них
+type memoryGroup struct {
+	next      int64
+	committed int64
+	// members число открытых брокеров группы
+	members int
+}
+
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{topics: make(map[string]*memoryTopic)}
+}
+
+// Broker возвращает MessageBroker для топика. При пустом groupID брокер только публикует сообщения.
+// Если у группы нет открытых брокеров, как после перезапуска в kafka, чтение продолжается
+// с последнего закоммиченного offset. Участники, уже читающие группу, свою позицию не теряют.
+func (l *MemoryLog) Broker(topic, groupID string) *MemoryBroker {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := l.topic(topic)
+	if groupID != "" {
+		group, ok := t.groups[groupID]
+		if !ok {
+			group = &memoryGroup{next: t.base, committed: t.base}
+			t.groups[groupID] = group
+		}
+		if group.members == 0 {
+			group.next = group.committed
+		}
+		group.members++
+	}
+
+	return &MemoryBroker{log: l, topic: topic, groupID: groupID, closed: make(chan struct{})}
+}
+
+func (l *MemoryLog) topic(name string) *memoryTopic {
+	t, ok := l.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: make(map[string]*memoryGroup), notify: make(chan struct{})}
+		l.topics[name] = t
+	}
+	return t
+}
+
+// compact удаляет сообщения, закоммиченные всеми группами, и сообщения сверх memoryRetention.
+// Топик без групп хранит только последние memoryRetention сообщений.
+func (t *memoryTopic) compact() {
+	end := t.base + int64(len(t.messages))
+
+	// Без групп сообщения хранятся для групп, которые подключатся позже
+	low := t.base
+	if len(t.groups) > 0 {
+		low = end
+		for _, group := range t.groups {
+			low = min(low, group.committed)
+		}
+	}
+	low = max(low, end-memoryRetention)
+
+	if low > t.base {
+		t.messages = t.messages[low-t.base:]
+		t.base = low
+	}
+	for _, group := range t.groups {
+		group.next = max(group.next, t.base)
+		group.committed = max(group.committed, t.base)
+	}
+}
+
+// MemoryBroker реализация MessageBroker поверх MemoryLog
+type MemoryBroker struct {
+	log     *MemoryLog
+	topic   string
+	groupID string
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (b *MemoryBroker) SendMessage(ctx context.Context, key, value []byte) error {
+	return b.SendMessages(ctx, Message{Key: key, Value: value})
+}
+
+func (b *MemoryBroker) SendMessages(ctx context.Context, msgs ...Message) error {
+	select {
+	case <-b.closed:
+		return fmt.Errorf("failed to send message to topic '%s': %w", b.topic, io.ErrClosedPipe)
+	default:
+	}
+
+	b.log.mu.Lock()
+	defer b.log.mu.Unlock()
+
+	ctxHeaders := TraceHeaders(ctx)
+	t := b.log.topic(b.topic)
+	for _, msg := range msgs {
+		headers := msg.Headers
+		if len(headers) == 0 {
+			headers = ctxHeaders
+		}
+		t.messages = append(t.messages, Message{
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Headers:   headers,
+			Topic:     b.topic,
+			Partition: 0,
+			Offset:    t.base + int64(len(t.messages)),
+		})
+		metrics.ObserveProduce(b.topic, nil)
+	}
+	t.compact()
+
+	close(t.notify)
+	t.notify = make(chan struct{})
+
+	return nil
+}
+
+func (b *MemoryBroker) ReadMessage(ctx context.Context) (key, value []byte, err error) {
+	msg, err := b.FetchMessage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = b.CommitMessages(ctx, msg); err != nil {
+		return nil, nil, err
+	}
+	return msg.Key, msg.Value, nil
+}
+
+// FetchMessage ждет следующее сообщение группы, пока не отменен ctx или брокер не закрыт
+func (b *MemoryBroker) FetchMessage(ctx context.Context) (Message, error) {
+	if b.groupID == "" {
+		return Message{}, ErrNoConsumer
+	}
+
+	for {
+		b.log.mu.Lock()
+		t := b.log.topic(b.topic)
+		group := t.groups[b.groupID]
+		if group.next < t.base+int64(len(t.messages)) {
+			msg := t.messages[group.next-t.base]
+			group.next++
+			lag := t.base + int64(len(t.messages)) - group.next
+			b.log.mu.Unlock()
+
+			metrics.KafkaConsumedCounter.WithLabelValues(b.topic).Inc()
+			metrics.KafkaConsumerLagGauge.WithLabelValues(b.topic).Set(float64(lag))
+			return msg, nil
+		}
+		notify := t.notify
+		b.log.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, fmt.Errorf("failed to fetch message from topic '%s': %w", b.topic, ctx.Err())
+		case <-b.closed:
+			return Message{}, io.EOF
+		case <-notify:
+		}
+	}
+}
+
+func (b *MemoryBroker) CommitMessages(ctx context.Context, msgs ...Message) error {
+	if b.groupID == "" {
+		return ErrNoConsumer
+	}
+
+	b.log.mu.Lock()
+	defer b.log.mu.Unlock()
+
+	t := b.log.topic(b.topic)
+	group := t.groups[b.groupID]
+	for _, msg := range msgs {
+		if msg.Topic == b.topic && msg.Offset+1 > group.committed {
+			group.committed = msg.Offset + 1
+		}
+	}
+	t.compact()
+
+	return nil
+}
+
+// Close закрывает брокер, ожидающий FetchMessage возвращает io.EOF
+func (b *MemoryBroker) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+		if b.groupID == "" {
+			return
+		}
+
+		b.log.mu.Lock()
+		defer b.log.mu.Unlock()
+		b.log.topic(b.topic).groups[b.groupID].members--
+	})
+	return nil
+}
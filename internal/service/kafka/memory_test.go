@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func send(t *testing.T, broker *MemoryBroker, values ...string) {
+	t.Helper()
+	for _, value := range values {
+		if err := broker.SendMessage(context.Background(), []byte("key"), []byte(value)); err != nil {
+			t.Fatalf("SendMessage(%q): %v", value, err)
+		}
+	}
+}
+
+func fetch(t *testing.T, broker *MemoryBroker) Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := broker.FetchMessage(ctx)
+	if err != nil {
+		t.Fatalf("FetchMessage: %v", err)
+	}
+	return msg
+}
+
+func TestMemoryBrokerFetchInOrder(t *testing.T) {
+	log := NewMemoryLog()
+	producer := log.Broker("events", "")
+	consumer := log.Broker("events", "group")
+
+	send(t, producer, "a", "b", "c")
+	for i, want := range []string{"a", "b", "c"} {
+		msg := fetch(t, consumer)
+		if string(msg.Value) != want || msg.Offset != int64(i) || msg.Topic != "events" {
+			t.Errorf("message %d = %q at offset %d in %q, want %q at %d", i, msg.Value, msg.Offset, msg.Topic, want, i)
+		}
+	}
+}
+
+func TestMemoryBrokerFetchWaitsForMessage(t *testing.T) {
+	log := NewMemoryLog()
+	consumer := log.Broker("events", "group")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		send(t, log.Broker("events", ""), "late")
+	}()
+
+	if msg := fetch(t, consumer); string(msg.Value) != "late" {
+		t.Errorf("value = %q, want late", msg.Value)
+	}
+}
+
+func TestMemoryBrokerFetchStopsOnCancelAndClose(t *testing.T) {
+	log := NewMemoryLog()
+	consumer := log.Broker("events", "group")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := consumer.FetchMessage(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchMessage after cancel error = %v, want context.Canceled", err)
+	}
+
+	consumer.Close()
+	if _, err := consumer.FetchMessage(context.Background()); !errors.Is(err, io.EOF) {
+		t.Errorf("FetchMessage after Close error = %v, want io.EOF", err)
+	}
+}
+
+func TestMemoryBrokerWithoutGroupCannotConsume(t *testing.T) {
+	producer := NewMemoryLog().Broker("events", "")
+	if _, err := producer.FetchMessage(context.Background()); !errors.Is(err, ErrNoConsumer) {
+		t.Errorf("FetchMessage error = %v, want ErrNoConsumer", err)
+	}
+	if err := producer.CommitMessages(context.Background()); !errors.Is(err, ErrNoConsumer) {
+		t.Errorf("CommitMessages error = %v, want ErrNoConsumer", err)
+	}
+}
+
+func TestMemoryBrokerRewindsToCommittedAfterRestart(t *testing.T) {
+	log := NewMemoryLog()
+	send(t, log.Broker("events", ""), "a", "b", "c")
+
+	consumer := log.Broker("events", "group")
+	first := fetch(t, consumer)
+	fetch(t, consumer)
+	if err := consumer.CommitMessages(context.Background(), first); err != nil {
+		t.Fatalf("CommitMessages: %v", err)
+	}
+	consumer.Close()
+
+	// Незакоммиченное сообщение "b" доставляется снова
+	restarted := log.Broker("events", "group")
+	if msg := fetch(t, restarted); string(msg.Value) != "b" {
+		t.Errorf("value after restart = %q, want b", msg.Value)
+	}
+}
+
+func TestMemoryBrokerNewMemberDoesNotRewindActiveMember(t *testing.T) {
+	log := NewMemoryLog()
+	send(t, log.Broker("events", ""), "a", "b", "c")
+
+	first := log.Broker("events", "group")
+	fetch(t, first)
+	fetch(t, first)
+
+	// Участники группы делят очередь: второй получает следующее сообщение, а не уже выданные
+	second := log.Broker("events", "group")
+	if msg := fetch(t, second); string(msg.Value) != "c" {
+		t.Errorf("value for new member = %q, want c", msg.Value)
+	}
+}
+
+func TestMemoryBrokerCommitCompactsTopic(t *testing.T) {
+	log := NewMemoryLog()
+	send(t, log.Broker("events", ""), "a", "b", "c")
+
+	slow := log.Broker("events", "slow")
+	fast := log.Broker("events", "fast")
+	for range 3 {
+		if err := fast.CommitMessages(context.Background(), fetch(t, fast)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(log.topics["events"].messages); got != 3 {
+		t.Fatalf("messages kept = %d, want 3 until the slow group commits", got)
+	}
+
+	if err := slow.CommitMessages(context.Background(), fetch(t, slow), fetch(t, slow)); err != nil {
+		t.Fatal(err)
+	}
+	topic := log.topics["events"]
+	if len(topic.messages) != 1 || topic.base != 2 {
+		t.Errorf("messages = %d from base %d, want 1 from base 2", len(topic.messages), topic.base)
+	}
+	if msg := fetch(t, slow); string(msg.Value) != "c" || msg.Offset != 2 {
+		t.Errorf("next message = %q at %d, want c at 2", msg.Value, msg.Offset)
+	}
+}
+
+func TestMemoryBrokerRetentionWithoutGroups(t *testing.T) {
+	log := NewMemoryLog()
+	producer := log.Broker("events", "")
+	for i := range memoryRetention + 5 {
+		send(t, producer, strconv.Itoa(i))
+	}
+
+	topic := log.topics["events"]
+	if len(topic.messages) != memoryRetention || topic.base != 5 {
+		t.Fatalf("messages = %d from base %d, want %d from base 5", len(topic.messages), topic.base, memoryRetention)
+	}
+
+	// Группа, созданная позже, начинает с самого старого хранимого сообщения
+	if msg := fetch(t, log.Broker("events", "group")); string(msg.Value) != "5" || msg.Offset != 5 {
+		t.Errorf("first message = %q at %d, want 5 at 5", msg.Value, msg.Offset)
+	}
+}
@@ -9,10 +9,27 @@ import (
 type (
 	Service interface {
 		EnsureUserExists(ctx context.Context, user model.User) error
+		GetUser(ctx context.Context, userID model.UserID) (*model.User, error)
+		UserLocation(ctx context.Context, userID model.UserID) (*time.Location, error)
+		SetTimezone(ctx context.Context, user model.User, timezone string) error
+		DeliveryState(ctx context.Context, userID model.UserID) (model.DeliveryState, error)
+		SetDeliveryState(ctx context.Context, user model.User, state model.DeliveryState, reason string) (bool, error)
+		UpdateDeliveryState(ctx context.Context, userID model.UserID, state model.DeliveryState, reason string) (bool, error)
 		Create(ctx context.Context, note model.Note) (model.NoteID, error)
 		Get(ctx context.Context, noteID model.NoteID, userID model.UserID) (*model.Note, error)
+		Update(ctx context.Context, note model.Note) error
 		Delete(ctx context.Context, noteID model.NoteID, userID model.UserID) error
+		SetRecurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, recurrence string) error
+		Patch(ctx context.Context, noteID model.NoteID, userID model.UserID, patch model.NotePatch) error
+		SkipOccurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, notifyAt time.Time) error
+		Snooze(ctx context.Context, noteID model.NoteID, userID model.UserID, notifyAt time.Time) error
+		Acknowledge(ctx context.Context, noteID model.NoteID, userID model.UserID) error
+		MarkSent(ctx context.Context, refs []model.NoteRef) (int64, error)
+		CompleteDelivery(ctx context.Context, note model.Note, owner string, nextNotifyAt *time.Time) error
+		MarkFailed(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string) error
 		List(ctx context.Context, userID model.UserID, showDeleted bool) ([]model.Note, error)
-		ReceiveNotifications(ctx context.Context, startTime, endTime time.Time) ([]model.Note, error)
+		ListPage(ctx context.Context, userID model.UserID, filter model.NoteFilter) ([]model.Note, error)
+		ClaimNotifications(ctx context.Context, owner string, dueBefore time.Time, lease time.Duration, limit int) ([]model.Note, int, error)
+		ClaimStats(ctx context.Context) (model.ClaimStats, error)
 	}
 )
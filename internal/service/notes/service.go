@@ -2,8 +2,11 @@ package notes
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/kotche/bot/internal/model"
 	"github.com/kotche/bot/internal/repository/notes"
+	"github.com/kotche/bot/internal/service/kafka"
 	"time"
 )
 
@@ -11,6 +14,7 @@ type DefaultService struct {
 	repo notes.Repository
 }
 
+// NewDefaultService создает сервис заметок, события об изменении заметок пишутся в outbox
 func NewDefaultService(repo notes.Repository) *DefaultService {
 	return &DefaultService{repo: repo}
 }
@@ -22,9 +26,15 @@ func (d *DefaultService) EnsureUserExists(ctx context.Context, user model.User)
 	}
 
 	if !exists {
+		timezone := user.Timezone
+		if timezone == "" {
+			timezone = model.DefaultTimezone
+		}
+
 		err = d.repo.CreateUser(ctx, model.User{
-			ID:    user.ID,
-			Login: user.Login,
+			ID:       user.ID,
+			Login:    user.Login,
+			Timezone: timezone,
 		})
 
 		if err != nil {
@@ -35,14 +45,96 @@ func (d *DefaultService) EnsureUserExists(ctx context.Context, user model.User)
 	return nil
 }
 
+func (d *DefaultService) GetUser(ctx context.Context, userID model.UserID) (*model.User, error) {
+	return d.repo.GetUser(ctx, userID)
+}
+
+// UserLocation возвращает часовой пояс пользователя, для неизвестных пользователей - часовой пояс по умолчанию
+func (d *DefaultService) UserLocation(ctx context.Context, userID model.UserID) (*time.Location, error) {
+	timezone := model.DefaultTimezone
+
+	user, err := d.repo.GetUser(ctx, userID)
+	if err != nil && !errors.Is(err, model.ErrUserNotFound) {
+		return nil, err
+	}
+	if user != nil && user.Timezone != "" {
+		timezone = user.Timezone
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone '%s' of user '%d': %w", timezone, userID, err)
+	}
+	return loc, nil
+}
+
+// DeliveryState возвращает состояние доставки напоминаний пользователю, для неизвестных пользователей - DeliveryStateUnknown
+func (d *DefaultService) DeliveryState(ctx context.Context, userID model.UserID) (model.DeliveryState, error) {
+	user, err := d.repo.GetUser(ctx, userID)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return model.DeliveryStateUnknown, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.DeliveryState, nil
+}
+
+// SetDeliveryState записывает состояние доставки, создавая пользователя при необходимости.
+// Возвращает true, если состояние изменилось.
+func (d *DefaultService) SetDeliveryState(ctx context.Context, user model.User, state model.DeliveryState, reason string) (bool, error) {
+	if err := d.EnsureUserExists(ctx, user); err != nil {
+		return false, err
+	}
+	return d.repo.SetDeliveryState(ctx, user.ID, state, reason)
+}
+
+// UpdateDeliveryState меняет состояние доставки существующего пользователя, например владельца заметки.
+// Пользователь не создается; если состояние уже такое, запрос ничего не пишет и возвращает false.
+func (d *DefaultService) UpdateDeliveryState(ctx context.Context, userID model.UserID, state model.DeliveryState, reason string) (bool, error) {
+	return d.repo.SetDeliveryState(ctx, userID, state, reason)
+}
+
+func (d *DefaultService) SetTimezone(ctx context.Context, user model.User, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" || timezone == "Local" {
+		return model.ErrInvalidTimezone
+	}
+
+	if err := d.EnsureUserExists(ctx, user); err != nil {
+		return err
+	}
+
+	return d.repo.SetUserTimezone(ctx, user.ID, timezone)
+}
+
 func (d *DefaultService) Create(ctx context.Context, note model.Note) (model.NoteID, error) {
-	return d.repo.CreateNote(ctx, note)
+	return d.repo.CreateNote(ctx, note, func(noteID model.NoteID) (model.OutboxMessage, error) {
+		event := kafka.NewEvent(kafka.EventNoteCreated, noteID, note.UserID)
+		event.NotifyAt = &note.NotifyAt
+		event.Text = note.Text
+		if note.Recurrence != "" {
+			event.Recurrence = &note.Recurrence
+		}
+		return outboxMessage(ctx, event)
+	})
 }
 
 func (d *DefaultService) Get(ctx context.Context, noteID model.NoteID, userID model.UserID) (*model.Note, error) {
 	return d.repo.GetNote(ctx, noteID, userID)
 }
 
+func (d *DefaultService) Update(ctx context.Context, note model.Note) error {
+	event := kafka.NewEvent(kafka.EventNoteUpdated, note.ID, note.UserID)
+	event.NotifyAt = &note.NotifyAt
+	event.Text = note.Text
+	message, err := outboxMessage(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	return d.repo.UpdateNote(ctx, note, message)
+}
+
 func (d *DefaultService) Delete(ctx context.Context, noteID model.NoteID, userID model.UserID) error {
 	exists, err := d.repo.NoteExists(ctx, noteID, userID)
 	if err != nil {
@@ -53,13 +145,139 @@ func (d *DefaultService) Delete(ctx context.Context, noteID model.NoteID, userID
 		return model.ErrNoteNotFound
 	}
 
-	return d.repo.DeleteNote(ctx, noteID, userID)
+	message, err := outboxMessage(ctx, kafka.NewEvent(kafka.EventNoteDeleted, noteID, userID))
+	if err != nil {
+		return err
+	}
+
+	return d.repo.DeleteNote(ctx, noteID, userID, message)
+}
+
+func (d *DefaultService) SetRecurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, recurrence string) error {
+	event := kafka.NewEvent(kafka.EventNoteRecurrence, noteID, userID)
+	event.Recurrence = &recurrence
+	message, err := outboxMessage(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	return d.repo.SetRecurrence(ctx, noteID, userID, recurrence, message)
+}
+
+// Patch меняет переданные поля заметки в одной транзакции, поля должны быть уже проверены.
+// Для текста и времени пишется событие note.updated, для повторения - note.recurrence_set.
+func (d *DefaultService) Patch(ctx context.Context, noteID model.NoteID, userID model.UserID, patch model.NotePatch) error {
+	var events []kafka.Event
+	if patch.Text != nil || patch.NotifyAt != nil {
+		event := kafka.NewEvent(kafka.EventNoteUpdated, noteID, userID)
+		event.NotifyAt = patch.NotifyAt
+		if patch.Text != nil {
+			event.Text = *patch.Text
+		}
+		events = append(events, event)
+	}
+	if patch.Recurrence != nil {
+		event := kafka.NewEvent(kafka.EventNoteRecurrence, noteID, userID)
+		event.Recurrence = patch.Recurrence
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	messages := make([]model.OutboxMessage, 0, len(events))
+	for _, event := range events {
+		message, err := outboxMessage(ctx, event)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+
+	return d.repo.PatchNote(ctx, noteID, userID, patch, messages)
+}
+
+// SkipOccurrence переносит пропущенное срабатывание повторяющегося напоминания на notifyAt, не отмечая его отправленным
+func (d *DefaultService) SkipOccurrence(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string, notifyAt time.Time) error {
+	event := kafka.NewEvent(kafka.EventNoteRescheduled, noteID, userID)
+	event.NotifyAt = &notifyAt
+	message, err := outboxMessage(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	return d.repo.SkipOccurrence(ctx, noteID, userID, owner, notifyAt, message)
+}
+
+func (d *DefaultService) Snooze(ctx context.Context, noteID model.NoteID, userID model.UserID, notifyAt time.Time) error {
+	event := kafka.NewEvent(kafka.EventNoteSnoozed, noteID, userID)
+	event.NotifyAt = &notifyAt
+	message, err := outboxMessage(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	return d.repo.SnoozeNote(ctx, noteID, userID, notifyAt, message)
+}
+
+func (d *DefaultService) Acknowledge(ctx context.Context, noteID model.NoteID, userID model.UserID) error {
+	message, err := outboxMessage(ctx, kafka.NewEvent(kafka.EventNoteAcknowledged, noteID, userID))
+	if err != nil {
+		return err
+	}
+
+	return d.repo.AcknowledgeNote(ctx, noteID, userID, message)
+}
+
+func (d *DefaultService) MarkSent(ctx context.Context, refs []model.NoteRef) (int64, error) {
+	return d.repo.MarkSent(ctx, refs)
+}
+
+// CompleteDelivery фиксирует доставку напоминания и ставит событие о доставке в outbox
+func (d *DefaultService) CompleteDelivery(ctx context.Context, note model.Note, owner string, nextNotifyAt *time.Time) error {
+	event := kafka.NewEvent(kafka.EventNoteDelivered, note.ID, note.UserID)
+	notifyAt := note.NotifyAt
+	event.NotifyAt = &notifyAt
+	message, err := outboxMessage(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	return d.repo.CompleteDelivery(ctx, note, owner, nextNotifyAt, message)
+}
+
+func (d *DefaultService) MarkFailed(ctx context.Context, noteID model.NoteID, userID model.UserID, owner string) error {
+	message, err := outboxMessage(ctx, kafka.NewEvent(kafka.EventNoteFailed, noteID, userID))
+	if err != nil {
+		return err
+	}
+
+	return d.repo.MarkFailed(ctx, noteID, userID, owner, message)
 }
 
 func (d *DefaultService) List(ctx context.Context, userID model.UserID, showDeleted bool) ([]model.Note, error) {
 	return d.repo.ListNotes(ctx, userID, showDeleted)
 }
 
-func (d *DefaultService) ReceiveNotifications(ctx context.Context, startTime, endTime time.Time) ([]model.Note, error) {
-	return d.repo.ReceiveNotifications(ctx, startTime, endTime)
+// ListPage возвращает страницу заметок пользователя по фильтру
+func (d *DefaultService) ListPage(ctx context.Context, userID model.UserID, filter model.NoteFilter) ([]model.Note, error) {
+	return d.repo.ListNotesPage(ctx, userID, filter)
+}
+
+func (d *DefaultService) ClaimNotifications(ctx context.Context, owner string, dueBefore time.Time, lease time.Duration, limit int) ([]model.Note, int, error) {
+	return d.repo.ClaimNotifications(ctx, owner, dueBefore, lease, limit)
+}
+
+func (d *DefaultService) ClaimStats(ctx context.Context) (model.ClaimStats, error) {
+	return d.repo.ClaimStats(ctx)
+}
+
+// outboxMessage кодирует событие в сообщение outbox, контекст трассировки из ctx уходит в заголовки.
+// Событие пишется в одной транзакции с изменением заметки и публикуется relay notifier.
+func outboxMessage(ctx context.Context, event kafka.Event) (model.OutboxMessage, error) {
+	key, value, err := kafka.EncodeEvent(event)
+	if err != nil {
+		return model.OutboxMessage{}, err
+	}
+	return model.OutboxMessage{Key: key, Value: value, Headers: kafka.TraceHeaders(ctx)}, nil
 }
@@ -0,0 +1,13 @@
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	Service interface {
+		PublishPending(ctx context.Context, owner string, lease time.Duration, limit int) (int, error)
+		PurgePublished(ctx context.Context, retention time.Duration) (int64, error)
+	}
+)
@@ -0,0 +1,52 @@
+package outbox
+
+import (
+	"context"
+	"github.com/kotche/bot/infrastructure/tracing"
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/repository/outbox"
+	"github.com/kotche/bot/internal/service/kafka"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+type DefaultService struct {
+	repo   outbox.Repository
+	broker kafka.MessageBroker
+}
+
+func NewDefaultService(repo outbox.Repository, broker kafka.MessageBroker) *DefaultService {
+	return &DefaultService{repo: repo, broker: broker}
+}
+
+// PublishPending захватывает для owner на lease и публикует в kafka одной партией до limit сообщений из outbox,
+// возвращает число опубликованных
+func (d *DefaultService) PublishPending(ctx context.Context, owner string, lease time.Duration, limit int) (int, error) {
+	return d.repo.PublishBatch(ctx, owner, lease, limit, func(messages []model.OutboxMessage) error {
+		msgs := make([]kafka.Message, 0, len(messages))
+		spans := make([]trace.Span, 0, len(messages))
+		for _, message := range messages {
+			// Публикация продолжает трассировку, в которой событие было записано в outbox
+			msgCtx := kafka.Message{Headers: message.Headers}.Context(ctx)
+			msgCtx, span := tracing.StartSpan(msgCtx, "PublishOutbox")
+			spans = append(spans, span)
+			msgs = append(msgs, kafka.Message{Key: message.Key, Value: message.Value, Headers: kafka.TraceHeaders(msgCtx)})
+		}
+
+		err := d.broker.SendMessages(ctx, msgs...)
+		for _, span := range spans {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+		return err
+	})
+}
+
+// PurgePublished удаляет опубликованные сообщения старше retention
+func (d *DefaultService) PurgePublished(ctx context.Context, retention time.Duration) (int64, error) {
+	return d.repo.PurgePublished(ctx, time.Now().Add(-retention))
+}
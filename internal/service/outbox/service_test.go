@@ -0,0 +1,181 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/service/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const testOwner = "relay-1"
+
+// fakeRepository outbox в памяти: PublishBatch отдает неопубликованные сообщения одной партией
+type fakeRepository struct {
+	messages  []model.OutboxMessage
+	published map[int64]bool
+	errors    map[int64]string
+	batches   int
+	purgedAt  time.Time
+	// owners владельцы, для которых захватывались партии
+	owners []string
+}
+
+func newFakeRepository(messages ...model.OutboxMessage) *fakeRepository {
+	return &fakeRepository{messages: messages, published: map[int64]bool{}, errors: map[int64]string{}}
+}
+
+func (r *fakeRepository) PublishBatch(_ context.Context, owner string, _ time.Duration, limit int, publish func([]model.OutboxMessage) error) (int, error) {
+	r.owners = append(r.owners, owner)
+	var batch []model.OutboxMessage
+	for _, message := range r.messages {
+		if !r.published[message.ID] && len(batch) < limit {
+			batch = append(batch, message)
+		}
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	r.batches++
+	if err := publish(batch); err != nil {
+		for _, message := range batch {
+			r.errors[message.ID] = err.Error()
+		}
+		return 0, err
+	}
+	for _, message := range batch {
+		r.published[message.ID] = true
+	}
+	return len(batch), nil
+}
+
+func (r *fakeRepository) PurgePublished(_ context.Context, before time.Time) (int64, error) {
+	r.purgedAt = before
+	return 0, nil
+}
+
+// failingBroker брокер, отклоняющий любую отправку
+type failingBroker struct {
+	kafka.MessageBroker
+	calls int
+}
+
+func (b *failingBroker) SendMessages(context.Context, ...kafka.Message) error {
+	b.calls++
+	return errors.New("kafka unavailable")
+}
+
+func outboxMessage(t *testing.T, id int64, noteID model.NoteID) model.OutboxMessage {
+	t.Helper()
+	key, value, err := kafka.EncodeEvent(kafka.NewEvent(kafka.EventNoteDelivered, noteID, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.OutboxMessage{ID: id, Key: key, Value: value}
+}
+
+func TestPublishPendingSendsBatchInOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	repo := newFakeRepository(outboxMessage(t, 1, 10), outboxMessage(t, 2, 20), outboxMessage(t, 3, 30))
+	log := kafka.NewMemoryLog()
+	service := NewDefaultService(repo, log.Broker("notifications", ""))
+
+	published, err := service.PublishPending(ctx, testOwner, time.Minute, 2)
+	if err != nil || published != 2 {
+		t.Fatalf("PublishPending() = %d, %v, want 2, nil", published, err)
+	}
+	if published, err = service.PublishPending(ctx, testOwner, time.Minute, 2); err != nil || published != 1 {
+		t.Fatalf("second PublishPending() = %d, %v, want 1, nil", published, err)
+	}
+	if repo.batches != 2 {
+		t.Errorf("batches = %d, want 2", repo.batches)
+	}
+	for _, owner := range repo.owners {
+		if owner != testOwner {
+			t.Errorf("batch claimed for %q, want %q", owner, testOwner)
+		}
+	}
+
+	consumer := log.Broker("notifications", "test")
+	for _, want := range []model.NoteID{10, 20, 30} {
+		msg, err := consumer.FetchMessage(ctx)
+		if err != nil {
+			t.Fatalf("FetchMessage: %v", err)
+		}
+		event, err := kafka.DecodeEvent(msg.Key, msg.Value)
+		if err != nil {
+			t.Fatalf("DecodeEvent: %v", err)
+		}
+		if event.NoteID != want {
+			t.Errorf("note id = %d, want %d", event.NoteID, want)
+		}
+	}
+}
+
+func TestPublishPendingKeepsMessagesOnBrokerError(t *testing.T) {
+	repo := newFakeRepository(outboxMessage(t, 1, 10), outboxMessage(t, 2, 20))
+	broker := &failingBroker{}
+	service := NewDefaultService(repo, broker)
+
+	published, err := service.PublishPending(context.Background(), testOwner, time.Minute, 10)
+	if err == nil || published != 0 {
+		t.Fatalf("PublishPending() = %d, %v, want 0 and error", published, err)
+	}
+	if broker.calls != 1 {
+		t.Errorf("broker calls = %d, want one call for the whole batch", broker.calls)
+	}
+	for _, id := range []int64{1, 2} {
+		if repo.published[id] {
+			t.Errorf("message %d marked as published", id)
+		}
+		if repo.errors[id] == "" {
+			t.Errorf("message %d has no recorded error", id)
+		}
+	}
+}
+
+func TestPurgePublishedUsesRetention(t *testing.T) {
+	repo := newFakeRepository()
+	service := NewDefaultService(repo, &failingBroker{})
+
+	start := time.Now()
+	if _, err := service.PurgePublished(context.Background(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(-time.Hour); repo.purgedAt.Before(want.Add(-time.Second)) || repo.purgedAt.After(time.Now().Add(-time.Hour)) {
+		t.Errorf("purged before %s, want about %s", repo.purgedAt, want)
+	}
+}
+
+func TestPublishPendingPropagatesTraceHeaders(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	message := outboxMessage(t, 1, 10)
+	message.Headers = map[string]string{"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"}
+
+	log := kafka.NewMemoryLog()
+	service := NewDefaultService(newFakeRepository(message), log.Broker("notifications", ""))
+	if _, err := service.PublishPending(ctx, testOwner, time.Minute, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := log.Broker("notifications", "test").FetchMessage(ctx)
+	if err != nil {
+		t.Fatalf("FetchMessage: %v", err)
+	}
+	if !strings.Contains(msg.Headers["traceparent"], traceID) {
+		t.Errorf("traceparent = %q, want trace %s", msg.Headers["traceparent"], traceID)
+	}
+}
@@ -0,0 +1,14 @@
+package tokens
+
+import (
+	"context"
+	"github.com/kotche/bot/internal/model"
+)
+
+type (
+	Service interface {
+		Issue(ctx context.Context, userID model.UserID) (string, error)
+		Authenticate(ctx context.Context, token string) (model.UserID, error)
+		Revoke(ctx context.Context, userID model.UserID) (int64, error)
+	}
+)
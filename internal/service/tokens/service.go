@@ -0,0 +1,57 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/kotche/bot/internal/model"
+	"github.com/kotche/bot/internal/repository/tokens"
+	"strings"
+)
+
+const (
+	// tokenPrefix отличает токены бота от других секретов, например в логах и сканерах утечек
+	tokenPrefix = "nb_"
+	tokenBytes  = 32
+)
+
+type DefaultService struct {
+	repo tokens.Repository
+}
+
+func NewDefaultService(repo tokens.Repository) *DefaultService {
+	return &DefaultService{repo: repo}
+}
+
+// Issue выпускает новый токен пользователя. Пользователь должен существовать.
+func (d *DefaultService) Issue(ctx context.Context, userID model.UserID) (string, error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+
+	token := tokenPrefix + hex.EncodeToString(raw)
+	if err := d.repo.CreateToken(ctx, userID, hash(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Authenticate возвращает владельца токена или model.ErrInvalidToken
+func (d *DefaultService) Authenticate(ctx context.Context, token string) (model.UserID, error) {
+	if !strings.HasPrefix(token, tokenPrefix) || len(token) != len(tokenPrefix)+2*tokenBytes {
+		return 0, model.ErrInvalidToken
+	}
+	return d.repo.UserByToken(ctx, hash(token))
+}
+
+func (d *DefaultService) Revoke(ctx context.Context, userID model.UserID) (int64, error) {
+	return d.repo.RevokeTokens(ctx, userID)
+}
+
+func hash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,273 @@
+package timeparse
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultHour час напоминания, если указана только дата
+	defaultHour = 9
+)
+
+var (
+	ErrUnrecognized = errors.New("time not recognized")
+
+	compactDurationRe = regexp.MustCompile(`^(\d+)([a-zа-яё]+)$`)
+	clockRe           = regexp.MustCompile(`^(\d{1,2})(?:[:.](\d{2}))?(am|pm)?$`)
+	dayMonthRe        = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})(?:\.(\d{2}|\d{4}))?$`)
+)
+
+var durationUnits = map[string]time.Duration{
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"м": time.Minute, "мин": time.Minute, "минуту": time.Minute, "минуты": time.Minute, "минут": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"ч": time.Hour, "час": time.Hour, "часа": time.Hour, "часов": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"д": 24 * time.Hour, "день": 24 * time.Hour, "дня": 24 * time.Hour, "дней": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+	"нед": 7 * 24 * time.Hour, "неделю": 7 * 24 * time.Hour, "недели": 7 * 24 * time.Hour, "недель": 7 * 24 * time.Hour,
+}
+
+var weekdays = map[string]time.Weekday{
+	"monday": time.Monday, "mon": time.Monday, "понедельник": time.Monday, "пн": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "вторник": time.Tuesday, "вт": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday, "среда": time.Wednesday, "среду": time.Wednesday, "ср": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "четверг": time.Thursday, "чт": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday, "пятница": time.Friday, "пятницу": time.Friday, "пт": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday, "суббота": time.Saturday, "субботу": time.Saturday, "сб": time.Saturday,
+	"sunday": time.Sunday, "sun": time.Sunday, "воскресенье": time.Sunday, "вс": time.Sunday,
+}
+
+// Parse разбирает время напоминания в начале input относительно now.
+// Возвращает время и оставшийся текст (например, текст заметки после даты).
+// Поддерживаются форматы: "через 2 часа", "in 30m", "завтра в 9", "next monday 18:00",
+// "2025-12-25 14:00", "25.12 14:00", "18:00".
+func Parse(input string, now time.Time) (time.Time, string, error) {
+	fields := strings.Fields(input)
+	tokens := make([]string, len(fields))
+	for i, field := range fields {
+		tokens[i] = strings.ToLower(field)
+	}
+
+	if at, n, ok := parseRelative(tokens, now); ok {
+		return at, strings.Join(fields[n:], " "), nil
+	}
+
+	if at, n, ok := parseISO(tokens, now.Location()); ok {
+		return at, strings.Join(fields[n:], " "), nil
+	}
+
+	date, n, hasDate := parseDate(tokens, now)
+	hour, minute, m, hasClock := parseClock(tokens[n:])
+	n += m
+
+	switch {
+	case hasDate && hasClock:
+		return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, now.Location()),
+			strings.Join(fields[n:], " "), nil
+	case hasDate:
+		return time.Date(date.Year(), date.Month(), date.Day(), defaultHour, 0, 0, 0, now.Location()),
+			strings.Join(fields[n:], " "), nil
+	case hasClock:
+		at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, strings.Join(fields[n:], " "), nil
+	}
+
+	return time.Time{}, input, ErrUnrecognized
+}
+
+// parseRelative разбирает "через 2 часа", "через полчаса", "in 30m", "in an hour"
+func parseRelative(tokens []string, now time.Time) (time.Time, int, bool) {
+	if len(tokens) < 2 || (tokens[0] != "через" && tokens[0] != "in") {
+		return time.Time{}, 0, false
+	}
+
+	if tokens[1] == "полчаса" {
+		return now.Add(30 * time.Minute), 2, true
+	}
+
+	if match := compactDurationRe.FindStringSubmatch(tokens[1]); match != nil {
+		unit, ok := durationUnits[match[2]]
+		if !ok {
+			return time.Time{}, 0, false
+		}
+		at, ok := addAmount(now, match[1], unit)
+		return at, 2, ok
+	}
+
+	if unit, ok := durationUnits[tokens[1]]; ok {
+		return now.Add(unit), 2, true
+	}
+
+	if len(tokens) < 3 {
+		return time.Time{}, 0, false
+	}
+	unit, ok := durationUnits[tokens[2]]
+	if !ok {
+		return time.Time{}, 0, false
+	}
+
+	amount := tokens[1]
+	if amount == "a" || amount == "an" {
+		amount = "1"
+	}
+	at, ok := addAmount(now, amount, unit)
+	return at, 3, ok
+}
+
+// addAmount прибавляет к now amount единиц unit; слишком большое число не принимается
+func addAmount(now time.Time, amount string, unit time.Duration) (time.Time, bool) {
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || n < 0 || n > int64(math.MaxInt64/unit) {
+		return time.Time{}, false
+	}
+	return now.Add(time.Duration(n) * unit), true
+}
+
+// parseISO разбирает "2025-12-25T14:00:00+03:00", "2025-12-25T14:00" и "2025-12-25 14:00"
+func parseISO(tokens []string, loc *time.Location) (time.Time, int, bool) {
+	if len(tokens) == 0 {
+		return time.Time{}, 0, false
+	}
+
+	if at, err := time.Parse(time.RFC3339, strings.ToUpper(tokens[0])); err == nil {
+		return at, 1, true
+	}
+	if at, err := time.ParseInLocation("2006-01-02t15:04", tokens[0], loc); err == nil {
+		return at, 1, true
+	}
+	if len(tokens) > 1 {
+		if at, err := time.ParseInLocation("2006-01-02 15:04", tokens[0]+" "+tokens[1], loc); err == nil {
+			return at, 2, true
+		}
+	}
+
+	return time.Time{}, 0, false
+}
+
+// parseDate разбирает день: "сегодня", "завтра", "next monday", "в пятницу", "2025-12-25", "25.12"
+func parseDate(tokens []string, now time.Time) (time.Time, int, bool) {
+	if len(tokens) == 0 {
+		return time.Time{}, 0, false
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch tokens[0] {
+	case "сегодня", "today":
+		return today, 1, true
+	case "завтра", "tomorrow":
+		return today.AddDate(0, 0, 1), 1, true
+	case "послезавтра":
+		return today.AddDate(0, 0, 2), 1, true
+	}
+
+	n := 0
+	switch tokens[0] {
+	case "next", "в", "во", "on":
+		n = 1
+	}
+	if n < len(tokens) {
+		if weekday, ok := weekdays[tokens[n]]; ok {
+			days := (int(weekday) - int(today.Weekday()) + 7) % 7
+			if days == 0 {
+				days = 7
+			}
+			return today.AddDate(0, 0, days), n + 1, true
+		}
+	}
+
+	if date, err := time.ParseInLocation("2006-01-02", tokens[0], now.Location()); err == nil {
+		return date, 1, true
+	}
+
+	if match := dayMonthRe.FindStringSubmatch(tokens[0]); match != nil {
+		day, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		if month < 1 || month > 12 || day < 1 {
+			return time.Time{}, 0, false
+		}
+
+		if match[3] != "" {
+			year, _ := strconv.Atoi(match[3])
+			if year < 100 {
+				year += 2000
+			}
+			if day > daysIn(time.Month(month), year) {
+				return time.Time{}, 0, false
+			}
+			return time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location()), 1, true
+		}
+
+		// Без года берется ближайшая такая дата: 29.02 переносится на следующий високосный год
+		for year := now.Year(); year <= now.Year()+8; year++ {
+			if day > daysIn(time.Month(month), year) {
+				continue
+			}
+			date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location())
+			if !date.Before(today) {
+				return date, 1, true
+			}
+		}
+		return time.Time{}, 0, false
+	}
+
+	return time.Time{}, 0, false
+}
+
+// parseClock разбирает время суток: "в 9", "at 18:00", "14:30", "9pm".
+// Без предлога "в"/"at" принимается только время с минутами или am/pm, чтобы не путать его с текстом.
+func parseClock(tokens []string) (hour, minute, n int, ok bool) {
+	if len(tokens) == 0 {
+		return 0, 0, 0, false
+	}
+
+	hasPrefix := false
+	switch tokens[0] {
+	case "в", "во", "at":
+		hasPrefix = true
+		n = 1
+	}
+	if n >= len(tokens) {
+		return 0, 0, 0, false
+	}
+
+	match := clockRe.FindStringSubmatch(tokens[n])
+	if match == nil || (!hasPrefix && match[2] == "" && match[3] == "") {
+		return 0, 0, 0, false
+	}
+
+	hour, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+
+	switch match[3] {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+
+	if hour > 23 || minute > 59 {
+		return 0, 0, 0, false
+	}
+
+	return hour, minute, n + 1, true
+}
+
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
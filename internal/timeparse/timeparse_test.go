@@ -0,0 +1,84 @@
+package timeparse
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	// среда, 15 мая 2024 года, 10:30
+	now := time.Date(2024, time.May, 15, 10, 30, 0, 0, loc)
+
+	tests := []struct {
+		name  string
+		input string
+		want  time.Time
+		rest  string
+	}{
+		{"через часа", "через 2 часа купить хлеб", now.Add(2 * time.Hour), "купить хлеб"},
+		{"через полчаса", "через полчаса позвонить", now.Add(30 * time.Minute), "позвонить"},
+		{"in compact", "in 30m stretch", now.Add(30 * time.Minute), "stretch"},
+		{"in an hour", "in an hour call mom", now.Add(time.Hour), "call mom"},
+		{"через неделю", "через неделю", now.AddDate(0, 0, 7), ""},
+		{"завтра в 9", "завтра в 9 встреча", time.Date(2024, time.May, 16, 9, 0, 0, 0, loc), "встреча"},
+		{"сегодня без времени", "сегодня отчет", time.Date(2024, time.May, 15, 9, 0, 0, 0, loc), "отчет"},
+		{"next monday", "next monday 18:00 gym", time.Date(2024, time.May, 20, 18, 0, 0, 0, loc), "gym"},
+		{"тот же день недели", "в среду в 8", time.Date(2024, time.May, 22, 8, 0, 0, 0, loc), ""},
+		{"iso с пробелом", "2025-12-25 14:00 подарки", time.Date(2025, time.December, 25, 14, 0, 0, 0, loc), "подарки"},
+		{"rfc3339", "2025-12-25T14:00:00+00:00 x", time.Date(2025, time.December, 25, 14, 0, 0, 0, time.UTC), "x"},
+		{"день и месяц", "25.12 14:00 елка", time.Date(2024, time.December, 25, 14, 0, 0, 0, loc), "елка"},
+		{"прошедшая дата переносится", "01.03 полив", time.Date(2025, time.March, 1, 9, 0, 0, 0, loc), "полив"},
+		{"29.02 с високосным годом", "29.02.2028 в 10", time.Date(2028, time.February, 29, 10, 0, 0, 0, loc), ""},
+		{"29.02 без года", "29.02 бал", time.Date(2028, time.February, 29, 9, 0, 0, 0, loc), "бал"},
+		{"короткий год", "01.06.25", time.Date(2025, time.June, 1, 9, 0, 0, 0, loc), ""},
+		{"время уже прошло", "09:00 зарядка", time.Date(2024, time.May, 16, 9, 0, 0, 0, loc), "зарядка"},
+		{"pm", "9pm кино", time.Date(2024, time.May, 15, 21, 0, 0, 0, loc), "кино"},
+		{"12am", "at 12am", time.Date(2024, time.May, 16, 0, 0, 0, 0, loc), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := Parse(tt.input, now)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.input, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+			if rest != tt.rest {
+				t.Errorf("Parse(%q) rest = %q, want %q", tt.input, rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	now := time.Date(2024, time.May, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"пустая строка", ""},
+		{"просто текст", "купить молоко"},
+		{"29.02 в невисокосный год", "29.02.2025"},
+		{"31 число в 30-дневном месяце", "31.04.2024"},
+		{"13 месяц", "10.13.2024"},
+		{"час без предлога", "9 утра"},
+		{"25 часов", "в 25"},
+		{"переполнение числа", "через 99999999999999999999 минут"},
+		{"переполнение длительности", "in 9999999999999w"},
+		{"отрицательное число", "через -5 минут"},
+		{"неизвестная единица", "через 5 лет"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _, err := Parse(tt.input, now); !errors.Is(err, ErrUnrecognized) {
+				t.Errorf("Parse(%q) = %s, %v, want ErrUnrecognized", tt.input, got, err)
+			}
+		})
+	}
+}
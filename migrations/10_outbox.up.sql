@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS outbox (
+        id BIGSERIAL PRIMARY KEY,
+        key BYTEA NOT NULL,
+        value BYTEA NOT NULL,
+        -- заголовки kafka, в том числе контекст трассировки
+        headers JSONB NOT NULL DEFAULT '{}',
+        attempts INT NOT NULL DEFAULT 0,
+        last_error TEXT,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        published_at TIMESTAMPTZ
+    );
+
+CREATE INDEX idx_outbox_unpublished ON outbox (id) WHERE published_at IS NULL;
+
+-- Удаление опубликованных сообщений старше срока хранения
+CREATE INDEX idx_outbox_published ON outbox (published_at) WHERE published_at IS NOT NULL;
\ No newline at end of file
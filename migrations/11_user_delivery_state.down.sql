@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS chk_users_delivery_state,
+    DROP COLUMN IF EXISTS delivery_state,
+    DROP COLUMN IF EXISTS delivery_error,
+    DROP COLUMN IF EXISTS delivery_state_at;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Существующие пользователи уже получали напоминания, новые считаются неизвестными до первой отправки
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS delivery_state TEXT NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS delivery_error TEXT,
+    ADD COLUMN IF NOT EXISTS delivery_state_at TIMESTAMPTZ;
+
+ALTER TABLE users ALTER COLUMN delivery_state SET DEFAULT 'unknown';
+
+ALTER TABLE users ADD CONSTRAINT chk_users_delivery_state
+    CHECK (delivery_state IN ('unknown', 'active', 'blocked', 'chat_not_found'));
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+        id BIGSERIAL PRIMARY KEY,
+        user_id INT8 NOT NULL,
+        -- хранится только sha256 токена, сам токен показывается пользователю один раз
+        token_hash BYTEA NOT NULL UNIQUE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        last_used_at TIMESTAMPTZ,
+        revoked_at TIMESTAMPTZ,
+        CONSTRAINT fk_api_tokens_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens (user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_outbox_unpublished_key;
+
+ALTER TABLE outbox
+    DROP COLUMN IF EXISTS claimed_by,
+    DROP COLUMN IF EXISTS claim_expires_at;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS claimed_by TEXT,
+    ADD COLUMN IF NOT EXISTS claim_expires_at TIMESTAMPTZ;
+
+-- Поиск более ранних неопубликованных сообщений того же пользователя при захвате партии
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished_key ON outbox (key, id) WHERE published_at IS NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS dialogs;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS dialogs (
+        chat_id INT8 PRIMARY KEY,
+        state TEXT NOT NULL,
+        text TEXT NOT NULL DEFAULT '',
+        month INT NOT NULL DEFAULT 0,
+        day INT NOT NULL DEFAULT 0,
+        notify_at TIMESTAMP,
+        updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+    );
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS recurrence TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_notes_notify_at_deleted_at_ordered;
+CREATE INDEX idx_notes_notify_at_deleted_at_ordered
+    ON notes (notify_at ASC)
+    INCLUDE (id, user_id, text, recurrence, created_at)
+    WHERE deleted_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,14 @@
+ALTER TABLE dialogs
+    ALTER COLUMN notify_at TYPE TIMESTAMP USING notify_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'Europe/Moscow';
+
+ALTER TABLE notes
+    ALTER COLUMN notify_at TYPE TIMESTAMP USING notify_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN deleted_at TYPE TIMESTAMP USING deleted_at AT TIME ZONE 'Europe/Moscow';
+
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN deleted_at TYPE TIMESTAMP USING deleted_at AT TIME ZONE 'Europe/Moscow';
+
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
\ No newline at end of file
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Europe/Moscow';
+
+-- Существующие значения записаны по московскому времени
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN deleted_at TYPE TIMESTAMPTZ USING deleted_at AT TIME ZONE 'Europe/Moscow';
+
+ALTER TABLE notes
+    ALTER COLUMN notify_at TYPE TIMESTAMPTZ USING notify_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN deleted_at TYPE TIMESTAMPTZ USING deleted_at AT TIME ZONE 'Europe/Moscow';
+
+ALTER TABLE dialogs
+    ALTER COLUMN notify_at TYPE TIMESTAMPTZ USING notify_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'Europe/Moscow';
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE dialogs
+    DROP COLUMN IF EXISTS note_id,
+    DROP COLUMN IF EXISTS edit_target;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE dialogs
+    ADD COLUMN IF NOT EXISTS note_id INT8 NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS edit_target TEXT NOT NULL DEFAULT '';
\ No newline at end of file
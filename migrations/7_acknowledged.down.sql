@@ -0,0 +1 @@
+ALTER TABLE notes DROP COLUMN IF EXISTS acknowledged_at;
\ No newline at end of file
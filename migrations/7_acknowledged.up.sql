@@ -0,0 +1 @@
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMPTZ;
\ No newline at end of file
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_notes_pending_notify_at;
+
+UPDATE notes SET deleted_at = COALESCE(sent_at, notify_at) WHERE status IN ('sent', 'acknowledged', 'failed');
+
+CREATE INDEX idx_notes_notify_at_deleted_at_ordered
+    ON notes (notify_at ASC)
+    INCLUDE (id, user_id, text, recurrence, created_at)
+    WHERE deleted_at IS NULL;
+
+ALTER TABLE notes
+    DROP CONSTRAINT IF EXISTS chk_notes_status,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS sent_at,
+    DROP COLUMN IF EXISTS attempts;
\ No newline at end of file
@@ -0,0 +1,20 @@
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending',
+    ADD COLUMN IF NOT EXISTS sent_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+
+-- Раньше отправленные заметки удалялись мягко: удаленные не раньше времени напоминания считаем отправленными
+UPDATE notes SET status = 'acknowledged', sent_at = notify_at WHERE acknowledged_at IS NOT NULL;
+UPDATE notes SET status = 'sent', sent_at = notify_at
+    WHERE status = 'pending' AND deleted_at IS NOT NULL AND deleted_at >= notify_at;
+UPDATE notes SET status = 'cancelled' WHERE status = 'pending' AND deleted_at IS NOT NULL;
+UPDATE notes SET deleted_at = NULL WHERE status IN ('sent', 'acknowledged');
+
+ALTER TABLE notes ADD CONSTRAINT chk_notes_status
+    CHECK (status IN ('pending', 'sent', 'acknowledged', 'cancelled', 'failed'));
+
+DROP INDEX IF EXISTS idx_notes_notify_at_deleted_at_ordered;
+CREATE INDEX idx_notes_pending_notify_at
+    ON notes (notify_at ASC)
+    INCLUDE (id, user_id, text, recurrence, created_at)
+    WHERE status = 'pending';
\ No newline at end of file
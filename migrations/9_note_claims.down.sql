@@ -0,0 +1,3 @@
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS claimed_by,
+    DROP COLUMN IF EXISTS claim_expires_at;
\ No newline at end of file